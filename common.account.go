@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/PagerDuty/go-pagerduty"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/webdevops/pagerduty-exporter/config"
+)
+
+const (
+	// PagerDutyDefaultAccount is the name of the account configured by the auth token options
+	PagerDutyDefaultAccount = "default"
+)
+
+var (
+	// account names are used in cache file names and metric labels
+	pagerdutyAccountNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+)
+
+type (
+	// PagerDutyAccount is a PagerDuty (sub)account scraped by its own set of collectors
+	PagerDutyAccount struct {
+		Name string
+
+		// settings are replaced on config reload
+		settings  atomic.Pointer[pagerDutyAccountSettings]
+		transport *pagerdutyTransport
+
+		// time zones of the users (from the User collector)
+		userTimeZones     map[string]string
+		userTimeZonesLock sync.RWMutex
+	}
+
+	// pagerDutyAccountSettings are the settings and the client of the account, settings must not be modified
+	pagerDutyAccountSettings struct {
+		config.PagerDutyAccount
+
+		Client *pagerduty.Client
+	}
+)
+
+// loadPagerDutyAccounts builds the account list from the accounts file, the config file or the auth token options
+func loadPagerDutyAccounts(opts *config.Opts) error {
+	if opts.PagerDuty.AccountsFile != "" {
+		content, err := os.ReadFile(opts.PagerDuty.AccountsFile)
+		if err != nil {
+			return fmt.Errorf(`failed to read accounts file: %w`, err)
+		}
+
+		opts.PagerDuty.Accounts = nil
+		if err := decodeYaml(content, &opts.PagerDuty.Accounts); err != nil {
+			return fmt.Errorf(`failed to parse accounts file "%v": %w`, opts.PagerDuty.AccountsFile, err)
+		}
+
+		if len(opts.PagerDuty.Accounts) == 0 {
+			return fmt.Errorf(`accounts file "%v" doesn't contain any account`, opts.PagerDuty.AccountsFile)
+		}
+	}
+
+	if len(opts.PagerDuty.Accounts) == 0 {
+		opts.PagerDuty.Accounts = []config.PagerDutyAccount{
+			{
+				Name:          PagerDutyDefaultAccount,
+				AuthToken:     opts.PagerDuty.AuthToken,
+				AuthTokenFile: opts.PagerDuty.AuthTokenFile,
+				ApiUrl:        opts.PagerDuty.ApiUrl,
+				TeamFilter:    opts.PagerDuty.Teams.Filter,
+			},
+		}
+	}
+
+	accountNames := map[string]bool{}
+	for i := range opts.PagerDuty.Accounts {
+		account := &opts.PagerDuty.Accounts[i]
+
+		if !pagerdutyAccountNameRegexp.MatchString(account.Name) {
+			return fmt.Errorf(`account #%d: invalid name "%v" (allowed characters: a-z, A-Z, 0-9, _ and -)`, i+1, account.Name)
+		}
+
+		if accountNames[account.Name] {
+			return fmt.Errorf(`account "%v": duplicate name`, account.Name)
+		}
+		accountNames[account.Name] = true
+
+		// global options are used as defaults
+		if account.ApiUrl == "" {
+			account.ApiUrl = opts.PagerDuty.ApiUrl
+		}
+
+		if len(account.TeamFilter) == 0 {
+			account.TeamFilter = opts.PagerDuty.Teams.Filter
+		}
+
+		// Load the AuthTokenFile into the AuthToken with some validation
+		if account.AuthTokenFile != "" {
+			data, err := os.ReadFile(account.AuthTokenFile)
+			if err != nil {
+				return fmt.Errorf(`account "%v": failed to read token from file: %w`, account.Name, err)
+			}
+			account.AuthToken = strings.TrimSpace(string(data))
+		}
+
+		if account.AuthToken == "" {
+			return fmt.Errorf(`account "%v": an authtoken or an authtokenfile must be specified`, account.Name)
+		}
+	}
+
+	return nil
+}
+
+// applyConfig (re)builds the PagerDuty client with the token and API url of the account config,
+// running collectors keep their current client until the next run
+func (a *PagerDutyAccount) applyConfig(accountConfig config.PagerDutyAccount) {
+	settings := &pagerDutyAccountSettings{PagerDutyAccount: accountConfig}
+
+	clientOpts := []pagerduty.ClientOptions{}
+	if settings.ApiUrl != "" {
+		clientOpts = append(clientOpts, pagerduty.WithAPIEndpoint(settings.ApiUrl))
+	}
+
+	settings.Client = pagerduty.NewClient(settings.AuthToken, clientOpts...)
+	settings.Client.HTTPClient = &http.Client{
+		Transport: a.transport,
+	}
+
+	a.settings.Store(settings)
+}
+
+// currentSettings returns the current settings and client of the account
+func (a *PagerDutyAccount) currentSettings() *pagerDutyAccountSettings {
+	return a.settings.Load()
+}
+
+// isMultiAccount returns true if more than one account is scraped
+func isMultiAccount() bool {
+	return len(PagerDutyAccounts) > 1
+}
+
+// collectorName returns the unique collector name for the account
+func (a *PagerDutyAccount) collectorName(name string) string {
+	if isMultiAccount() {
+		return fmt.Sprintf("%s/%s", a.Name, name)
+	}
+	return name
+}
+
+// cacheName returns the cache file name for the account, the default account uses the
+// plain name to keep existing caches
+func (a *PagerDutyAccount) cacheName(name string) string {
+	if a.Name == PagerDutyDefaultAccount {
+		return name
+	}
+	return fmt.Sprintf("%s.%s", a.Name, name)
+}
+
+// cachePath returns the namespaced cache path for the account
+func (a *PagerDutyAccount) cachePath(name string) *string {
+	return Opts.GetCachePath(a.cacheName(name))
+}
+
+// constLabels returns the labels which are added to all metrics of the account
+func (a *PagerDutyAccount) constLabels() prometheus.Labels {
+	return prometheus.Labels{"account": a.Name}
+}
+
+func (a *PagerDutyAccount) logger() *slog.Logger {
+	return logger.Slog().With(slog.String("account", a.Name))
+}
+
+// setUserTimeZones sets the time zones of the users of the account
+func (a *PagerDutyAccount) setUserTimeZones(timeZones map[string]string) {
+	a.userTimeZonesLock.Lock()
+	defer a.userTimeZonesLock.Unlock()
+	a.userTimeZones = timeZones
+}
+
+// userTimeZone returns the time zone of the user (empty if unknown)
+func (a *PagerDutyAccount) userTimeZone(userID string) string {
+	a.userTimeZonesLock.RLock()
+	defer a.userTimeZonesLock.RUnlock()
+	return a.userTimeZones[userID]
+}
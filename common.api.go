@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/PagerDuty/go-pagerduty"
+)
+
+const (
+	// PagerDutyDefaultApiUrl is the PagerDuty REST API url used if no API url is configured
+	PagerDutyDefaultApiUrl = "https://api.pagerduty.com"
+)
+
+// apiGet calls a PagerDuty REST API endpoint which is not supported by go-pagerduty and decodes the
+// response into v, failed requests return a pagerduty.APIError (same as the go-pagerduty client)
+func (a *PagerDutyAccount) apiGet(ctx context.Context, path string, query url.Values, headers map[string]string, v interface{}) error {
+	settings := a.currentSettings()
+
+	apiUrl := settings.ApiUrl
+	if apiUrl == "" {
+		apiUrl = PagerDutyDefaultApiUrl
+	}
+
+	requestUrl := strings.TrimSuffix(apiUrl, "/") + path
+	if len(query) > 0 {
+		requestUrl += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, requestUrl, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build request: %w", err)
+	}
+
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := settings.Client.Do(req, true)
+	if err != nil {
+		return fmt.Errorf("error calling the API endpoint: %w", err)
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := pagerduty.APIError{StatusCode: resp.StatusCode}
+		_ = json.NewDecoder(resp.Body).Decode(&apiErr)
+		return apiErr
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,409 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/jessevdk/go-flags"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.yaml.in/yaml/v3"
+
+	"github.com/webdevops/pagerduty-exporter/config"
+)
+
+var (
+	yamlTypeErrorRegexp = regexp.MustCompile(`^(line [0-9]+: field [^ ]+ not found) in type .*$`)
+
+	// currentOpts is the current (reloaded) config, collector runs and webhook requests use a snapshot,
+	// Opts is the config from startup and is never changed
+	currentOpts atomic.Pointer[config.Opts]
+
+	prometheusConfigReloadSuccess          prometheus.Gauge
+	prometheusConfigReloadSuccessTimestamp prometheus.Gauge
+)
+
+// loadConfig merges the config file into the parsed options (flags and env variables take precedence),
+// validates the options and loads the accounts
+func loadConfig(parser *flags.Parser, opts *config.Opts) error {
+	if opts.Config.File != "" {
+		content, err := os.ReadFile(opts.Config.File)
+		if err != nil {
+			return fmt.Errorf(`failed to read config file: %w`, err)
+		}
+
+		if err := decodeYaml(content, opts); err != nil {
+			return fmt.Errorf(`failed to parse config file "%v": %w`, opts.Config.File, err)
+		}
+
+		// parse flags and env variables again (without defaults) so they take precedence over the config file
+		forEachOption(parser, func(option *flags.Option) {
+			option.Default = nil
+		})
+		if _, err := parser.Parse(); err != nil {
+			return err
+		}
+	}
+
+	// config file values are not validated by the parser
+	var validationErr error
+	forEachOption(parser, func(option *flags.Option) {
+		if len(option.Choices) == 0 || validationErr != nil {
+			return
+		}
+
+		values := []string{}
+		switch value := option.Value().(type) {
+		case string:
+			values = append(values, value)
+		case []string:
+			values = value
+		}
+
+		for _, value := range values {
+			if !slices.Contains(option.Choices, value) {
+				validationErr = fmt.Errorf(`invalid value "%v" for option "%v", allowed values are: %v`, value, option.LongNameWithNamespace(), strings.Join(option.Choices, ", "))
+				return
+			}
+		}
+	})
+	if validationErr != nil {
+		return validationErr
+	}
+
+	if len(opts.PagerDuty.Incident.Statuses) == 1 {
+		if strings.ToLower(opts.PagerDuty.Incident.Statuses[0]) == "all" {
+			opts.PagerDuty.Incident.Statuses = []string{
+				"triggered",
+				"acknowledged",
+				"resolved",
+			}
+		}
+	}
+
+	if err := loadPiiHashKey(opts); err != nil {
+		return err
+	}
+
+	if err := validateMetricFamilies(opts); err != nil {
+		return err
+	}
+
+	if err := validateNotificationPeriods(opts); err != nil {
+		return err
+	}
+
+	if err := validateOnCallAccounting(opts); err != nil {
+		return err
+	}
+
+	if opts.ScrapeTime.EscalationPolicy == nil {
+		opts.ScrapeTime.EscalationPolicy = &opts.ScrapeTime.General
+	}
+
+	if opts.ScrapeTime.MaintenanceWindow == nil {
+		opts.ScrapeTime.MaintenanceWindow = &opts.ScrapeTime.General
+	}
+
+	if opts.ScrapeTime.Schedule == nil {
+		opts.ScrapeTime.Schedule = &opts.ScrapeTime.General
+	}
+
+	if opts.ScrapeTime.Service == nil {
+		opts.ScrapeTime.Service = &opts.ScrapeTime.General
+	}
+	if opts.ScrapeTime.BusinessService == nil {
+		opts.ScrapeTime.BusinessService = &opts.ScrapeTime.General
+	}
+
+	if opts.ScrapeTime.Team == nil {
+		opts.ScrapeTime.Team = &opts.ScrapeTime.General
+	}
+
+	if opts.ScrapeTime.User == nil {
+		opts.ScrapeTime.User = &opts.ScrapeTime.General
+	}
+
+	return loadPagerDutyAccounts(opts)
+}
+
+// currentConfig returns the current config, the config must not be modified
+func currentConfig() *config.Opts {
+	if opts := currentOpts.Load(); opts != nil {
+		return opts
+	}
+	return &Opts
+}
+
+// decodeYaml decodes YAML (or JSON) content and fails on unknown fields
+func decodeYaml(content []byte, v interface{}) error {
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		var typeErr *yaml.TypeError
+		if errors.As(err, &typeErr) {
+			// strip the (anonymous struct) type names from the error messages
+			messages := []string{}
+			for _, message := range typeErr.Errors {
+				messages = append(messages, yamlTypeErrorRegexp.ReplaceAllString(message, "$1"))
+			}
+			return errors.New(strings.Join(messages, "; "))
+		}
+		return err
+	}
+	return nil
+}
+
+func forEachOption(parser *flags.Parser, callback func(option *flags.Option)) {
+	var walk func(groups []*flags.Group)
+	walk = func(groups []*flags.Group) {
+		for _, group := range groups {
+			for _, option := range group.Options() {
+				callback(option)
+			}
+			walk(group.Groups())
+		}
+	}
+	walk(parser.Groups())
+}
+
+// startConfigReloader reloads the config on SIGHUP or if the config, accounts or token files have been changed
+func startConfigReloader() {
+	prometheusConfigReloadSuccess = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "pagerduty_exporter_config_last_reload_success",
+			Help: "Pagerduty exporter status of last config reload (1 = success)",
+		},
+	)
+	prometheus.MustRegister(prometheusConfigReloadSuccess)
+
+	prometheusConfigReloadSuccessTimestamp = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Name: "pagerduty_exporter_config_last_reload_success_timestamp_seconds",
+			Help: "Pagerduty exporter timestamp of last successful config (re)load",
+		},
+	)
+	prometheus.MustRegister(prometheusConfigReloadSuccessTimestamp)
+
+	prometheusConfigReloadSuccess.Set(1)
+	prometheusConfigReloadSuccessTimestamp.SetToCurrentTime()
+
+	signalChannel := make(chan os.Signal, 1)
+	signal.Notify(signalChannel, syscall.SIGHUP)
+
+	var tickerChannel <-chan time.Time
+	if Opts.Config.ReloadInterval > 0 {
+		tickerChannel = time.NewTicker(Opts.Config.ReloadInterval).C
+	}
+
+	go func() {
+		lastChecksum := configFilesChecksum()
+		for {
+			select {
+			case <-signalChannel:
+				logger.Info("received SIGHUP, reloading config")
+			case <-tickerChannel:
+				checksum := configFilesChecksum()
+				if checksum == lastChecksum {
+					continue
+				}
+				logger.Info("detected changed config files, reloading config")
+			}
+
+			if err := reloadConfig(); err != nil {
+				logger.Error("failed to reload config, keeping current config", slog.Any("error", err))
+				prometheusConfigReloadSuccess.Set(0)
+			} else {
+				logger.Info("config reloaded")
+				prometheusConfigReloadSuccess.Set(1)
+				prometheusConfigReloadSuccessTimestamp.SetToCurrentTime()
+			}
+
+			lastChecksum = configFilesChecksum()
+		}
+	}()
+}
+
+// configFilesChecksum returns the checksum of the content of all config, accounts and token files
+func configFilesChecksum() string {
+	opts := currentConfig()
+	files := []string{
+		opts.Config.File,
+		opts.PagerDuty.AccountsFile,
+		opts.PagerDuty.AuthTokenFile,
+		opts.PagerDuty.Pii.HashKeyFile,
+	}
+	for _, account := range opts.PagerDuty.Accounts {
+		files = append(files, account.AuthTokenFile)
+	}
+
+	hasher := sha256.New()
+	for _, path := range files {
+		if path == "" {
+			continue
+		}
+
+		// unreadable files are also a change, reload will report the error
+		content, err := os.ReadFile(path) // #nosec inside container
+		if err != nil {
+			content = []byte(err.Error())
+		}
+		hasher.Write([]byte(path))
+		hasher.Write(content)
+	}
+
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// reloadConfig parses and validates the config again and applies it to the running collectors,
+// running collectors finish with their current config snapshot
+func reloadConfig() error {
+	opts := config.Opts{}
+	parser := flags.NewParser(&opts, flags.None)
+	if _, err := parser.Parse(); err != nil {
+		return err
+	}
+
+	if err := loadConfig(parser, &opts); err != nil {
+		return err
+	}
+
+	current := currentConfig()
+	for _, setting := range configRestartRequired(current, &opts) {
+		logger.Warn("changed setting requires a restart and is ignored", slog.String("setting", setting))
+	}
+	keepRestartRequiredSettings(current, &opts)
+
+	for _, account := range PagerDutyAccounts {
+		accountIndex := slices.IndexFunc(opts.PagerDuty.Accounts, func(accountConfig config.PagerDutyAccount) bool {
+			return accountConfig.Name == account.Name
+		})
+		if accountIndex == -1 {
+			continue
+		}
+
+		account.applyConfig(opts.PagerDuty.Accounts[accountIndex])
+	}
+
+	currentOpts.Store(&opts)
+
+	return nil
+}
+
+// keepRestartRequiredSettings copies the settings which are only applied on startup from the current
+// config, so the reloaded config matches the running exporter
+func keepRestartRequiredSettings(current, updated *config.Opts) {
+	updated.Config = current.Config
+	updated.Logger = current.Logger
+	updated.Server = current.Server
+	updated.Cache = current.Cache
+	updated.PagerDuty.MaxConnections = current.PagerDuty.MaxConnections
+	updated.PagerDuty.RateLimit = current.PagerDuty.RateLimit
+	updated.PagerDuty.Webhook.Path = current.PagerDuty.Webhook.Path
+	updated.PagerDuty.Teams.Disable = current.PagerDuty.Teams.Disable
+
+	// disabled collectors stay disabled and enabled collectors stay enabled (the optional scrape times
+	// might point to the general scrape time, so the pointers are replaced)
+	optionalScrapeTimes := []struct {
+		current time.Duration
+		updated **time.Duration
+	}{
+		{current: *current.ScrapeTime.EscalationPolicy, updated: &updated.ScrapeTime.EscalationPolicy},
+		{current: *current.ScrapeTime.MaintenanceWindow, updated: &updated.ScrapeTime.MaintenanceWindow},
+		{current: *current.ScrapeTime.Schedule, updated: &updated.ScrapeTime.Schedule},
+		{current: *current.ScrapeTime.Service, updated: &updated.ScrapeTime.Service},
+		{current: *current.ScrapeTime.BusinessService, updated: &updated.ScrapeTime.BusinessService},
+		{current: *current.ScrapeTime.Team, updated: &updated.ScrapeTime.Team},
+		{current: *current.ScrapeTime.User, updated: &updated.ScrapeTime.User},
+	}
+	for _, scrapeTime := range optionalScrapeTimes {
+		if (scrapeTime.current > 0) != (**scrapeTime.updated > 0) {
+			value := scrapeTime.current
+			*scrapeTime.updated = &value
+		}
+	}
+
+	scrapeTimes := []struct {
+		current time.Duration
+		updated *time.Duration
+	}{
+		{current: current.ScrapeTime.Analytics, updated: &updated.ScrapeTime.Analytics},
+		{current: current.ScrapeTime.Timeline, updated: &updated.ScrapeTime.Timeline},
+		{current: current.ScrapeTime.LogStream, updated: &updated.ScrapeTime.LogStream},
+		{current: current.ScrapeTime.Summary, updated: &updated.ScrapeTime.Summary},
+		{current: current.ScrapeTime.System, updated: &updated.ScrapeTime.System},
+		{current: current.ScrapeTime.Live, updated: &updated.ScrapeTime.Live},
+	}
+	for _, scrapeTime := range scrapeTimes {
+		if (scrapeTime.current > 0) != (*scrapeTime.updated > 0) {
+			*scrapeTime.updated = scrapeTime.current
+		}
+	}
+}
+
+// configRestartRequired returns the changed settings which are only applied on startup
+func configRestartRequired(current, updated *config.Opts) (ret []string) {
+	accountNames := func(opts *config.Opts) (names []string) {
+		for _, account := range opts.PagerDuty.Accounts {
+			names = append(names, account.Name)
+		}
+		return
+	}
+
+	// collectors can't be started or stopped at runtime
+	enabledCollectors := func(opts *config.Opts) []bool {
+		return []bool{
+			opts.PagerDuty.Teams.Disable,
+			*opts.ScrapeTime.EscalationPolicy > 0,
+			*opts.ScrapeTime.MaintenanceWindow > 0,
+			*opts.ScrapeTime.Schedule > 0,
+			*opts.ScrapeTime.Service > 0,
+			*opts.ScrapeTime.BusinessService > 0,
+			*opts.ScrapeTime.Team > 0,
+			*opts.ScrapeTime.User > 0,
+			opts.ScrapeTime.Analytics > 0,
+			opts.ScrapeTime.Timeline > 0,
+			opts.ScrapeTime.LogStream > 0,
+			opts.ScrapeTime.Summary > 0,
+			opts.ScrapeTime.System > 0,
+			opts.ScrapeTime.Live > 0,
+		}
+	}
+
+	settings := []struct {
+		name    string
+		current interface{}
+		updated interface{}
+	}{
+		{name: "config", current: current.Config, updated: updated.Config},
+		{name: "logger", current: current.Logger, updated: updated.Logger},
+		{name: "server", current: current.Server, updated: updated.Server},
+		{name: "cache", current: current.Cache, updated: updated.Cache},
+		{name: "pagerDuty.accounts", current: accountNames(current), updated: accountNames(updated)},
+		{name: "pagerDuty.maxConnections", current: current.PagerDuty.MaxConnections, updated: updated.PagerDuty.MaxConnections},
+		{name: "pagerDuty.rateLimit", current: current.PagerDuty.RateLimit, updated: updated.PagerDuty.RateLimit},
+		{name: "pagerDuty.webhook.path", current: current.PagerDuty.Webhook.Path, updated: updated.PagerDuty.Webhook.Path},
+		{name: "scrapeTime (enabled collectors)", current: enabledCollectors(current), updated: enabledCollectors(updated)},
+	}
+
+	for _, setting := range settings {
+		if !reflect.DeepEqual(setting.current, setting.updated) {
+			ret = append(ret, setting.name)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/PagerDuty/go-pagerduty"
+)
+
+type (
+	// PagerDutyErrorClass classifies errors returned while talking to the PagerDuty API
+	PagerDutyErrorClass string
+
+	// CollectorError is a classified error of a PagerDuty API call
+	CollectorError struct {
+		Endpoint string
+		Class    PagerDutyErrorClass
+		Err      error
+	}
+)
+
+const (
+	ErrorClassAuth      PagerDutyErrorClass = "auth"
+	ErrorClassRateLimit PagerDutyErrorClass = "rate_limit"
+	ErrorClassNotFound  PagerDutyErrorClass = "not_found"
+	ErrorClassTransient PagerDutyErrorClass = "transient"
+	ErrorClassTimeout   PagerDutyErrorClass = "timeout"
+	ErrorClassUnknown   PagerDutyErrorClass = "unknown"
+)
+
+// NewCollectorError creates a classified error for a failed PagerDuty API call
+func NewCollectorError(endpoint string, err error) *CollectorError {
+	return &CollectorError{
+		Endpoint: endpoint,
+		Class:    classifyPagerDutyError(err),
+		Err:      err,
+	}
+}
+
+func (e *CollectorError) Error() string {
+	return fmt.Sprintf("%s failed (%s): %v", e.Endpoint, e.Class, e.Err)
+}
+
+func (e *CollectorError) Unwrap() error {
+	return e.Err
+}
+
+// IsAbort returns true if further requests of the current collector run are pointless
+// (eg. token is invalid or API rate limit is exceeded)
+func (e *CollectorError) IsAbort() bool {
+	switch e.Class {
+	case ErrorClassAuth, ErrorClassRateLimit:
+		return true
+	}
+	return false
+}
+
+// isAbortError checks if err is a CollectorError which should abort the collector run,
+// unclassified errors don't abort the run
+func isAbortError(err error) bool {
+	var collectorErr *CollectorError
+	if errors.As(err, &collectorErr) {
+		return collectorErr.IsAbort()
+	}
+	return false
+}
+
+func classifyPagerDutyError(err error) PagerDutyErrorClass {
+	var apiErr pagerduty.APIError
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.StatusCode == http.StatusUnauthorized, apiErr.StatusCode == http.StatusForbidden:
+			return ErrorClassAuth
+		case apiErr.RateLimited():
+			return ErrorClassRateLimit
+		case apiErr.NotFound(), apiErr.StatusCode == http.StatusPaymentRequired:
+			// PagerDuty returns 402 for features which are not available in the current plan
+			return ErrorClassNotFound
+		case apiErr.StatusCode == http.StatusRequestTimeout, apiErr.StatusCode == http.StatusGatewayTimeout:
+			return ErrorClassTimeout
+		case apiErr.Temporary():
+			return ErrorClassTransient
+		}
+		return ErrorClassUnknown
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrorClassTimeout
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		if netErr.Timeout() {
+			return ErrorClassTimeout
+		}
+		return ErrorClassTransient
+	}
+
+	// go-pagerduty does not wrap transport errors, so we can only inspect the message
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "Client.Timeout"),
+		strings.Contains(msg, "deadline exceeded"),
+		strings.Contains(msg, "timeout"):
+		return ErrorClassTimeout
+	case strings.Contains(msg, "error calling the API endpoint"):
+		return ErrorClassTransient
+	}
+
+	return ErrorClassUnknown
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type (
+	// collectorStatus tracks the runs of a collector for the readiness and liveness checks
+	collectorStatus struct {
+		lock sync.Mutex
+
+		// cache restore has been attempted (before the first run)
+		restoreAttempted bool
+
+		// time the current run waited for the request budget, rate limit resets and retries (not counted as stuck),
+		// waitingSince is set while requests of the run are waiting
+		runWaited    time.Duration
+		waitingSince *time.Time
+		waiting      int
+
+		Account           string              `json:"account"`
+		Collector         string              `json:"collector"`
+		Ready             bool                `json:"ready"`
+		Running           bool                `json:"running"`
+		Stuck             bool                `json:"stuck,omitempty"`
+		RestoredFromCache bool                `json:"restoredFromCache,omitempty"`
+		ScrapeTime        float64             `json:"scrapeTime"`
+		LastRun           *time.Time          `json:"lastRun"`
+		LastRunDuration   *float64            `json:"lastRunDuration"`
+		LastSuccess       *time.Time          `json:"lastSuccess"`
+		LastError         string              `json:"lastError,omitempty"`
+		LastErrorClass    PagerDutyErrorClass `json:"lastErrorClass,omitempty"`
+	}
+
+	healthResponse struct {
+		Status     string             `json:"status"`
+		Collectors []*collectorStatus `json:"collectors"`
+	}
+)
+
+var (
+	collectorStatusList     []*collectorStatus
+	collectorStatusListLock sync.Mutex
+
+	errCollectorPanic = errors.New("collector run failed unexpectedly (panic)")
+)
+
+// collectorStatusContextKey is the context key of the status of the collector run which sends the request
+type collectorStatusContextKey struct{}
+
+// contextWithCollectorStatus returns a context which passes the status to the PagerDuty transport
+func contextWithCollectorStatus(ctx context.Context, status *collectorStatus) context.Context {
+	return context.WithValue(ctx, collectorStatusContextKey{}, status)
+}
+
+// collectorStatusFromContext returns the status of the collector run of the request (nil if unknown)
+func collectorStatusFromContext(ctx context.Context) *collectorStatus {
+	status, _ := ctx.Value(collectorStatusContextKey{}).(*collectorStatus)
+	return status
+}
+
+func newCollectorStatus(account, collector string) *collectorStatus {
+	status := &collectorStatus{Account: account, Collector: collector}
+
+	collectorStatusListLock.Lock()
+	defer collectorStatusListLock.Unlock()
+	collectorStatusList = append(collectorStatusList, status)
+
+	return status
+}
+
+func (s *collectorStatus) runStarted(scrapeTime time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	s.Running = true
+	s.LastRun = &now
+	s.ScrapeTime = scrapeTime.Seconds()
+	s.runWaited = 0
+	if s.waitingSince != nil {
+		s.waitingSince = &now
+	}
+}
+
+// waitStarted records that a request of the run waits (request budget, rate limit reset or retry backoff)
+func (s *collectorStatus) waitStarted() {
+	if s == nil {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.waiting == 0 {
+		now := time.Now()
+		s.waitingSince = &now
+	}
+	s.waiting++
+}
+
+// waitFinished records the end of a wait started by waitStarted
+func (s *collectorStatus) waitFinished() {
+	if s == nil {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.waiting == 0 {
+		return
+	}
+	s.waiting--
+
+	if s.waiting == 0 && s.waitingSince != nil {
+		s.runWaited += time.Since(*s.waitingSince)
+		s.waitingSince = nil
+	}
+}
+
+// runFinished records the result of the run, err is the error which failed the run
+func (s *collectorStatus) runFinished(err error, withoutErrors bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	now := time.Now()
+	s.Running = false
+	if s.LastRun != nil {
+		duration := now.Sub(*s.LastRun).Seconds()
+		s.LastRunDuration = &duration
+	}
+
+	switch {
+	case err != nil:
+		s.setError(err)
+	case withoutErrors:
+		s.LastSuccess = &now
+		s.LastError = ""
+		s.LastErrorClass = ""
+	default:
+		// run finished with partial errors (already recorded)
+		s.LastSuccess = &now
+	}
+}
+
+// apiError records a failed PagerDuty API call
+func (s *collectorStatus) apiError(err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.setError(err)
+}
+
+func (s *collectorStatus) setError(err error) {
+	s.LastError = err.Error()
+	s.LastErrorClass = ""
+
+	var collectorErr *CollectorError
+	if errors.As(err, &collectorErr) {
+		s.LastErrorClass = collectorErr.Class
+	}
+}
+
+// hasRun returns true if the collector has started a run
+func (s *collectorStatus) hasRun() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.LastRun != nil
+}
+
+// cacheRestored records the cache restore before the first run, a repeated call means setting the
+// restored metrics failed (the collector resets the metrics)
+func (s *collectorStatus) cacheRestored(valid bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.LastRun != nil {
+		return
+	}
+
+	s.RestoredFromCache = valid && !s.restoreAttempted
+	s.restoreAttempted = true
+}
+
+// check updates the ready and stuck state and returns a copy of the status
+func (s *collectorStatus) check(now time.Time) *collectorStatus {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// a revoked token fails every run, collector is not ready even if the metrics are still available
+	s.Ready = (s.LastSuccess != nil || s.RestoredFromCache) && s.LastErrorClass != ErrorClassAuth
+
+	// waiting for the request budget or rate limits is progress, only the remaining run time counts
+	s.Stuck = false
+	if s.Running && s.ScrapeTime > 0 && Opts.Server.LivenessStuckFactor > 0 {
+		runDuration := now.Sub(*s.LastRun) - s.runWaited
+		if s.waitingSince != nil {
+			runDuration -= now.Sub(*s.waitingSince)
+		}
+		s.Stuck = runDuration.Seconds() > s.ScrapeTime*Opts.Server.LivenessStuckFactor
+	}
+
+	return &collectorStatus{
+		Account:           s.Account,
+		Collector:         s.Collector,
+		Ready:             s.Ready,
+		Running:           s.Running,
+		Stuck:             s.Stuck,
+		RestoredFromCache: s.RestoredFromCache,
+		ScrapeTime:        s.ScrapeTime,
+		LastRun:           s.LastRun,
+		LastRunDuration:   s.LastRunDuration,
+		LastSuccess:       s.LastSuccess,
+		LastError:         s.LastError,
+		LastErrorClass:    s.LastErrorClass,
+	}
+}
+
+// healthHandler returns the status of all collectors, the check decides if the collector is healthy
+func healthHandler(failedStatus string, check func(status *collectorStatus) bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		collectorStatusListLock.Lock()
+		statusList := collectorStatusList
+		collectorStatusListLock.Unlock()
+
+		now := time.Now()
+		response := healthResponse{Status: "ok", Collectors: []*collectorStatus{}}
+		for _, status := range statusList {
+			status := status.check(now)
+			if !check(status) {
+				response.Status = failedStatus
+			}
+			response.Collectors = append(response.Collectors, status)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if response.Status != "ok" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+
+		if err := json.NewEncoder(w).Encode(response); err != nil {
+			logger.Error(err.Error())
+		}
+	}
+}
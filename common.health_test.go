@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCollectorStatusStuck(t *testing.T) {
+	stuckFactor := Opts.Server.LivenessStuckFactor
+	Opts.Server.LivenessStuckFactor = 5
+	t.Cleanup(func() {
+		Opts.Server.LivenessStuckFactor = stuckFactor
+	})
+
+	now := time.Now()
+
+	tests := []struct {
+		name         string
+		runDuration  time.Duration
+		waited       time.Duration
+		waitingSince time.Duration
+		expected     bool
+	}{
+		{
+			name:        "within threshold",
+			runDuration: 4 * time.Minute,
+		},
+		{
+			name:        "exceeds threshold",
+			runDuration: 10 * time.Minute,
+			expected:    true,
+		},
+		{
+			name:        "waited for rate limit",
+			runDuration: 10 * time.Minute,
+			waited:      8 * time.Minute,
+		},
+		{
+			name:         "waiting for rate limit",
+			runDuration:  10 * time.Minute,
+			waitingSince: 8 * time.Minute,
+		},
+		{
+			name:        "exceeds threshold without waits",
+			runDuration: 20 * time.Minute,
+			waited:      8 * time.Minute,
+			expected:    true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lastRun := now.Add(-test.runDuration)
+			status := &collectorStatus{
+				Running:    true,
+				ScrapeTime: time.Minute.Seconds(),
+				LastRun:    &lastRun,
+				runWaited:  test.waited,
+			}
+			if test.waitingSince > 0 {
+				waitingSince := now.Add(-test.waitingSince)
+				status.waitingSince = &waitingSince
+				status.waiting = 1
+			}
+
+			if stuck := status.check(now).Stuck; stuck != test.expected {
+				t.Errorf("expected stuck: %v, got %v", test.expected, stuck)
+			}
+		})
+	}
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	prometheusCommon "github.com/webdevops/go-common/prometheus"
+	"github.com/webdevops/go-common/prometheus/collector"
+
+	"github.com/webdevops/pagerduty-exporter/config"
+)
+
+var (
+	PrometheusSeriesDropped *prometheus.CounterVec
+
+	// names of all metric families registered by the collectors
+	metricFamilyNames     = map[string]bool{}
+	metricFamilyNamesLock sync.Mutex
+)
+
+func initMetricGuardrails() {
+	PrometheusSeriesDropped = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "pagerduty_exporter_series_dropped_total",
+			Help: "Pagerduty exporter series which were dropped because the series limit of the metric family was exceeded",
+		},
+		[]string{
+			"account",
+			"metric",
+		},
+	)
+	prometheus.MustRegister(PrometheusSeriesDropped)
+}
+
+// validateMetricFamilies validates the metric family settings of the config
+func validateMetricFamilies(opts *config.Opts) error {
+	if opts.Metrics.MaxSeries < 0 {
+		return fmt.Errorf(`invalid value "%v" for option "metrics.max-series", must not be negative`, opts.Metrics.MaxSeries)
+	}
+
+	for name, family := range opts.Metrics.Families {
+		for label, length := range family.TruncateLabels {
+			if length <= 0 {
+				return fmt.Errorf(`metric "%v": invalid truncate length %v for label "%v"`, name, length, label)
+			}
+		}
+
+		if family.MaxSeries != nil && *family.MaxSeries < 0 {
+			return fmt.Errorf(`metric "%v": invalid maxSeries %v, must not be negative`, name, *family.MaxSeries)
+		}
+	}
+
+	return nil
+}
+
+// warnUnknownMetricFamilies logs configured metric families which are not exported by any collector
+func warnUnknownMetricFamilies() {
+	metricFamilyNamesLock.Lock()
+	defer metricFamilyNamesLock.Unlock()
+
+	for name := range Opts.Metrics.Families {
+		if !metricFamilyNames[name] {
+			logger.Warn("metric family settings found for unknown or disabled metric", slog.String("metric", name))
+		}
+	}
+}
+
+// registerMetricFamily marks the metric family as exported (for the validation of the metric family settings)
+func registerMetricFamily(name string) {
+	metricFamilyNamesLock.Lock()
+	defer metricFamilyNamesLock.Unlock()
+	metricFamilyNames[name] = true
+}
+
+// mustRegisterMetricFamily registers a metric which is not set by a metric list of the collector,
+// the collector has to apply the guardrails itself
+func mustRegisterMetricFamily(name string, vec prometheus.Collector) {
+	registerMetricFamily(name)
+	prometheus.MustRegister(vec)
+}
+
+// registerMetricList registers the metric list at the collector, the guardrails (label and series limits)
+// are applied to the list after each run
+func (p *PagerDutyProcessor) registerMetricList(name string, vec interface{}, reset bool) *collector.MetricList {
+	registerMetricFamily(name)
+
+	if p.metricVecs == nil {
+		p.metricVecs = map[string]interface{}{}
+	}
+	p.metricLists = append(p.metricLists, name)
+	p.metricVecs[name] = vec
+	return p.Collector.RegisterMetricList(name, vec, reset)
+}
+
+// validRestoredMetrics checks if the metrics restored from cache can be set (label names of the cached
+// series match the metric), invalid cached series fail the restore of the collector
+func (p *PagerDutyProcessor) validRestoredMetrics() bool {
+	for _, name := range p.metricLists {
+		for _, row := range p.Collector.GetMetricList(name).GetList() {
+			var err error
+			switch vec := p.metricVecs[name].(type) {
+			case *prometheus.GaugeVec:
+				_, err = vec.GetMetricWith(row.Labels)
+			case *prometheus.CounterVec:
+				_, err = vec.GetMetricWith(row.Labels)
+			case *prometheus.HistogramVec:
+				_, err = vec.GetMetricWith(row.Labels)
+			case *prometheus.SummaryVec:
+				_, err = vec.GetMetricWith(row.Labels)
+			}
+			if err != nil {
+				p.Logger().Warn("cached metrics are invalid", slog.String("metric", name), slog.Any("error", err))
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// applyMetricGuardrails applies the label settings and series limits to all metric lists of the collector,
+// disabled metric families are not exported
+func (p *PagerDutyProcessor) applyMetricGuardrails() {
+	for _, name := range p.metricLists {
+		metricList := p.Collector.GetMetricList(name).MetricList
+		if !p.applyMetricListGuardrails(name, metricList) {
+			metricList.Reset()
+		}
+	}
+}
+
+// applyMetricListGuardrails applies the label settings and series limit to the metric list,
+// returns false if the metric family is disabled
+func (p *PagerDutyProcessor) applyMetricListGuardrails(name string, metricList *prometheusCommon.MetricList) bool {
+	if metricFamilyDisabled(p.opts, name) {
+		return false
+	}
+	applyMetricLabelSettings(p.opts, name, metricList)
+	p.limitMetricSeries(p.opts, name, metricList)
+	return true
+}
+
+// admitCounterSeries applies the label settings to the labels of a counter which is never reset and returns
+// the labels of the series and false if the series is not exported (metric family disabled or series limit
+// exceeded), the series limit applies to all series since the start of the exporter
+func (p *PagerDutyProcessor) admitCounterSeries(name string, labels prometheus.Labels) (prometheus.Labels, bool) {
+	if metricFamilyDisabled(p.opts, name) {
+		return nil, false
+	}
+	labels = applyMetricLabels(p.opts, name, labels)
+
+	if p.counterSeries == nil {
+		p.counterSeries = map[string]map[string]bool{}
+	}
+	if p.counterSeries[name] == nil {
+		p.counterSeries[name] = map[string]bool{}
+	}
+
+	key := metricSeriesKey(labels)
+	if p.counterSeries[name][key] {
+		return labels, true
+	}
+
+	if maxSeries := metricSeriesLimit(p.opts, name); maxSeries > 0 && len(p.counterSeries[name]) >= maxSeries {
+		PrometheusSeriesDropped.WithLabelValues(p.account.Name, name).Inc()
+		return nil, false
+	}
+
+	p.counterSeries[name][key] = true
+	return labels, true
+}
+
+// metricFamilyDisabled returns true if the metric family is disabled in the config
+func metricFamilyDisabled(opts *config.Opts, name string) bool {
+	family, exists := opts.Metrics.Families[name]
+	return exists && family.Disabled
+}
+
+// applyMetricLabelSettings drops and truncates the label values of the metric family,
+// dropped labels are set to an empty value (same as a missing label for Prometheus);
+// collectors reuse label maps for multiple metric families, so the rows get their own label maps
+func applyMetricLabelSettings(opts *config.Opts, name string, metricList *prometheusCommon.MetricList) {
+	if !metricFamilyHasLabelSettings(opts, name) {
+		return
+	}
+
+	rows := metricList.GetList()
+	metricList.Reset()
+	for _, row := range rows {
+		metricList.Add(applyMetricLabels(opts, name, row.Labels), row.Value)
+	}
+}
+
+// metricFamilyHasLabelSettings returns true if labels of the metric family are dropped or truncated
+func metricFamilyHasLabelSettings(opts *config.Opts, name string) bool {
+	family, exists := opts.Metrics.Families[name]
+	return exists && (len(family.DropLabels) > 0 || len(family.TruncateLabels) > 0)
+}
+
+// applyMetricLabels returns the labels of a single series of the metric family with dropped and truncated
+// label values, the passed labels are not modified
+func applyMetricLabels(opts *config.Opts, name string, labels prometheus.Labels) prometheus.Labels {
+	if !metricFamilyHasLabelSettings(opts, name) {
+		return labels
+	}
+	family := opts.Metrics.Families[name]
+
+	ret := maps.Clone(labels)
+	for label, value := range ret {
+		if slices.Contains(family.DropLabels, label) {
+			ret[label] = ""
+		} else if length, truncate := family.TruncateLabels[label]; truncate {
+			ret[label] = truncateString(value, length, "…")
+		}
+	}
+	return ret
+}
+
+// metricSeriesLimit returns the series limit of the metric family (0 = unlimited)
+func metricSeriesLimit(opts *config.Opts, name string) int {
+	if family, exists := opts.Metrics.Families[name]; exists && family.MaxSeries != nil {
+		return *family.MaxSeries
+	}
+	return opts.Metrics.MaxSeries
+}
+
+// limitMetricSeries drops all series exceeding the series limit of the metric family,
+// the first series (in order of the collector) are kept
+func (p *PagerDutyProcessor) limitMetricSeries(opts *config.Opts, name string, metricList *prometheusCommon.MetricList) {
+	maxSeries := metricSeriesLimit(opts, name)
+	if maxSeries <= 0 {
+		return
+	}
+
+	rows := metricList.GetList()
+	series := map[string]bool{}
+	keptRows := make([]prometheusCommon.MetricRow, 0, len(rows))
+	droppedSeries := map[string]bool{}
+	for _, row := range rows {
+		key := metricSeriesKey(row.Labels)
+		if !series[key] && len(series) >= maxSeries {
+			droppedSeries[key] = true
+			continue
+		}
+		series[key] = true
+		keptRows = append(keptRows, row)
+	}
+
+	if len(droppedSeries) == 0 {
+		return
+	}
+
+	p.Logger().Warn(
+		"series limit of metric exceeded, dropping series",
+		slog.String("metric", name),
+		slog.Int("limit", maxSeries),
+		slog.Int("dropped", len(droppedSeries)),
+	)
+	PrometheusSeriesDropped.WithLabelValues(p.account.Name, name).Add(float64(len(droppedSeries)))
+
+	metricList.Reset()
+	for _, row := range keptRows {
+		metricList.Add(row.Labels, row.Value)
+	}
+}
+
+// incrementMetricRow increments the value of the row with the labels (rows are indexed by the series key)
+func incrementMetricRow(rows map[string]*prometheusCommon.MetricRow, labels prometheus.Labels) {
+	key := metricSeriesKey(labels)
+	if row, exists := rows[key]; exists {
+		row.Value++
+		return
+	}
+	rows[key] = &prometheusCommon.MetricRow{Labels: labels, Value: 1}
+}
+
+// metricSeriesKey returns an unique key for the label set of a series
+func metricSeriesKey(labels prometheus.Labels) string {
+	keys := make([]string, 0, len(labels))
+	for label, value := range labels {
+		keys = append(keys, label+"="+value)
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, "\xff")
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	prometheusCommon "github.com/webdevops/go-common/prometheus"
+
+	"github.com/webdevops/pagerduty-exporter/config"
+)
+
+func TestApplyMetricLabelSettings(t *testing.T) {
+	opts := &config.Opts{}
+	opts.Metrics.Families = map[string]config.MetricFamily{
+		"pagerduty_test_dropped":   {DropLabels: []string{"teamID"}},
+		"pagerduty_test_truncated": {TruncateLabels: map[string]int{"title": 5}},
+		"pagerduty_test_shorter":   {TruncateLabels: map[string]int{"title": 2}},
+	}
+
+	tests := []struct {
+		name     string
+		expected prometheus.Labels
+	}{
+		{
+			name:     "pagerduty_test_dropped",
+			expected: prometheus.Labels{"teamID": "", "title": "Database down"},
+		},
+		{
+			name:     "pagerduty_test_truncated",
+			expected: prometheus.Labels{"teamID": "PTEAM01", "title": "Data…"},
+		},
+		{
+			name:     "pagerduty_test_shorter",
+			expected: prometheus.Labels{"teamID": "PTEAM01", "title": "D…"},
+		},
+		{
+			name:     "pagerduty_test_unchanged",
+			expected: prometheus.Labels{"teamID": "PTEAM01", "title": "Database down"},
+		},
+	}
+
+	// collectors add the same label map to multiple metric families
+	labels := prometheus.Labels{"teamID": "PTEAM01", "title": "Database down"}
+	metricLists := map[string]*prometheusCommon.MetricList{}
+	for _, test := range tests {
+		metricLists[test.name] = prometheusCommon.NewMetricsList()
+		metricLists[test.name].Add(labels, 1)
+	}
+
+	for _, test := range tests {
+		applyMetricLabelSettings(opts, test.name, metricLists[test.name])
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rows := metricLists[test.name].GetList()
+			if len(rows) != 1 {
+				t.Fatalf("expected one row, got %v", rows)
+			}
+			for label, expected := range test.expected {
+				if value := rows[0].Labels[label]; value != expected {
+					t.Errorf("label %v: expected %q, got %q", label, expected, value)
+				}
+			}
+		})
+	}
+
+	if labels["teamID"] != "PTEAM01" || labels["title"] != "Database down" {
+		t.Errorf("labels of the collector were modified: %v", labels)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/webdevops/pagerduty-exporter/config"
+)
+
+const (
+	NotificationPeriodBusinessHours = "business_hours"
+	NotificationPeriodEvening       = "evening"
+	NotificationPeriodSleep         = "sleep"
+	NotificationPeriodWeekend       = "weekend"
+)
+
+type (
+	// hourWindow is a daily time window in minutes of the day, windows with start after end span midnight
+	hourWindow struct {
+		start int
+		end   int
+	}
+)
+
+// validateNotificationPeriods validates the hour windows and the default time zone of the notification periods
+func validateNotificationPeriods(opts *config.Opts) error {
+	if _, err := parseHourWindow(opts.PagerDuty.Notification.BusinessHours); err != nil {
+		return fmt.Errorf(`invalid value "%v" for option "pagerduty.notification.business-hours": %w`, opts.PagerDuty.Notification.BusinessHours, err)
+	}
+
+	if _, err := parseHourWindow(opts.PagerDuty.Notification.SleepHours); err != nil {
+		return fmt.Errorf(`invalid value "%v" for option "pagerduty.notification.sleep-hours": %w`, opts.PagerDuty.Notification.SleepHours, err)
+	}
+
+	if _, err := time.LoadLocation(opts.PagerDuty.Notification.DefaultTimeZone); err != nil {
+		return fmt.Errorf(`invalid value "%v" for option "pagerduty.notification.default-timezone": %w`, opts.PagerDuty.Notification.DefaultTimeZone, err)
+	}
+
+	return nil
+}
+
+// parseHourWindow parses a daily time window (HH:MM-HH:MM)
+func parseHourWindow(value string) (*hourWindow, error) {
+	startValue, endValue, found := strings.Cut(value, "-")
+	if !found {
+		return nil, fmt.Errorf(`expected format HH:MM-HH:MM`)
+	}
+
+	start, err := time.Parse("15:04", strings.TrimSpace(startValue))
+	if err != nil {
+		return nil, fmt.Errorf(`invalid start time: %w`, err)
+	}
+
+	end, err := time.Parse("15:04", strings.TrimSpace(endValue))
+	if err != nil {
+		return nil, fmt.Errorf(`invalid end time: %w`, err)
+	}
+
+	return &hourWindow{
+		start: start.Hour()*60 + start.Minute(),
+		end:   end.Hour()*60 + end.Minute(),
+	}, nil
+}
+
+// contains returns true if the time of the day is inside of the window
+func (w *hourWindow) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	if w.start <= w.end {
+		return minute >= w.start && minute < w.end
+	}
+	return minute >= w.start || minute < w.end
+}
+
+// notificationPeriod classifies the time in the time zone of the user (sleep hours, weekend, business hours or evening),
+// sleep hours take precedence over weekend days
+func notificationPeriod(opts *config.Opts, t time.Time, timeZone string) string {
+	notificationOpts := opts.PagerDuty.Notification
+
+	location, err := time.LoadLocation(timeZone)
+	if timeZone == "" || err != nil {
+		location, _ = time.LoadLocation(notificationOpts.DefaultTimeZone)
+	}
+	t = t.In(location)
+
+	if window, err := parseHourWindow(notificationOpts.SleepHours); err == nil && window.contains(t) {
+		return NotificationPeriodSleep
+	}
+
+	if slices.Contains(notificationOpts.WeekendDays, strings.ToLower(t.Weekday().String())) {
+		return NotificationPeriodWeekend
+	}
+
+	if window, err := parseHourWindow(notificationOpts.BusinessHours); err == nil && window.contains(t) {
+		return NotificationPeriodBusinessHours
+	}
+
+	return NotificationPeriodEvening
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/webdevops/pagerduty-exporter/config"
+)
+
+const (
+	OnCallDayTypeWeekday = "weekday"
+	OnCallDayTypeWeekend = "weekend"
+	OnCallDayTypeHoliday = "holiday"
+
+	OnCallHoursBusiness = "business"
+	OnCallHoursOff      = "off_hours"
+
+	// date format of the holidays
+	onCallHolidayFormat = "2006-01-02"
+)
+
+type (
+	// onCallInterval is a time interval a user is oncall
+	onCallInterval struct {
+		start time.Time
+		end   time.Time
+	}
+
+	// onCallTimeKey is the classification of oncall time
+	onCallTimeKey struct {
+		dayType string
+		hours   string
+	}
+)
+
+// validateOnCallAccounting validates the timeframes, business hours and holidays of the oncall time accounting and gaps
+func validateOnCallAccounting(opts *config.Opts) error {
+	if opts.PagerDuty.Schedule.OnCallLookBack < 0 || opts.PagerDuty.Schedule.OnCallLookAhead < 0 {
+		return fmt.Errorf(`invalid oncall time accounting timeframe, must not be negative`)
+	}
+
+	if opts.PagerDuty.Schedule.GapLookAhead < 0 {
+		return fmt.Errorf(`invalid value "%v" for option "pagerduty.schedule.gap-lookahead", must not be negative`, opts.PagerDuty.Schedule.GapLookAhead)
+	}
+
+	if _, err := parseHourWindow(opts.PagerDuty.Schedule.BusinessHours); err != nil {
+		return fmt.Errorf(`invalid value "%v" for option "pagerduty.schedule.business-hours": %w`, opts.PagerDuty.Schedule.BusinessHours, err)
+	}
+
+	for _, holiday := range opts.PagerDuty.Schedule.Holidays {
+		if _, err := time.Parse(onCallHolidayFormat, strings.TrimSpace(holiday)); err != nil {
+			return fmt.Errorf(`invalid value "%v" for option "pagerduty.schedule.holidays", expected format YYYY-MM-DD`, holiday)
+		}
+	}
+
+	return nil
+}
+
+// mergeOnCallIntervals clips the intervals to the timeframe and merges overlapping and adjacent intervals
+func mergeOnCallIntervals(intervals []onCallInterval, since, until time.Time) []onCallInterval {
+	clipped := make([]onCallInterval, 0, len(intervals))
+	for _, interval := range intervals {
+		if interval.start.Before(since) {
+			interval.start = since
+		}
+		if interval.end.After(until) {
+			interval.end = until
+		}
+		if interval.end.After(interval.start) {
+			clipped = append(clipped, interval)
+		}
+	}
+
+	sort.Slice(clipped, func(i, j int) bool {
+		return clipped[i].start.Before(clipped[j].start)
+	})
+
+	ret := []onCallInterval{}
+	for _, interval := range clipped {
+		if last := len(ret) - 1; last >= 0 && !interval.start.After(ret[last].end) {
+			if interval.end.After(ret[last].end) {
+				ret[last].end = interval.end
+			}
+			continue
+		}
+		ret = append(ret, interval)
+	}
+	return ret
+}
+
+// onCallGaps returns the uncovered intervals of the timeframe (complement of the oncall intervals)
+func onCallGaps(intervals []onCallInterval, since, until time.Time) []onCallInterval {
+	ret := []onCallInterval{}
+
+	current := since
+	for _, interval := range mergeOnCallIntervals(intervals, since, until) {
+		if interval.start.After(current) {
+			ret = append(ret, onCallInterval{start: current, end: interval.start})
+		}
+		current = interval.end
+	}
+
+	if until.After(current) {
+		ret = append(ret, onCallInterval{start: current, end: until})
+	}
+
+	return ret
+}
+
+// scheduleGap is a gap of the schedule, current gaps started before now (nobody oncall now)
+type scheduleGap struct {
+	onCallInterval
+	current bool
+}
+
+// scheduleGaps returns the gaps of the timeframe which end after now, the seconds until the next gap starts
+// (0 if nobody is oncall now, only valid if there are gaps) and the uncovered seconds from now until the end of the timeframe;
+// gaps which started before the timeframe are clipped to the start of the timeframe
+func scheduleGaps(intervals []onCallInterval, since, until, now time.Time) (gaps []scheduleGap, nextGap float64, uncovered float64) {
+	gaps = []scheduleGap{}
+	for _, gap := range onCallGaps(intervals, since, until) {
+		if !gap.end.After(now) {
+			continue
+		}
+
+		// uncovered time and next gap are counted from now
+		uncoveredSince := gap.start
+		if uncoveredSince.Before(now) {
+			uncoveredSince = now
+		}
+		uncovered += gap.end.Sub(uncoveredSince).Seconds()
+		if len(gaps) == 0 {
+			nextGap = uncoveredSince.Sub(now).Seconds()
+		}
+
+		gaps = append(gaps, scheduleGap{onCallInterval: gap, current: !gap.start.After(now)})
+	}
+
+	return gaps, nextGap, uncovered
+}
+
+// onCallCoverage returns the percentage of the timeframe covered by the intervals
+func onCallCoverage(intervals []onCallInterval, since, until time.Time) float64 {
+	if !until.After(since) {
+		return 0
+	}
+
+	covered := time.Duration(0)
+	for _, interval := range mergeOnCallIntervals(intervals, since, until) {
+		covered += interval.end.Sub(interval.start)
+	}
+	return covered.Seconds() / until.Sub(since).Seconds() * 100
+}
+
+// splitOnCallTime splits the (merged) intervals by day type (weekday, weekend or holiday) and hours (business or
+// off hours) in the time zone of the schedule and returns the oncall seconds per classification
+func splitOnCallTime(opts *config.Opts, intervals []onCallInterval, location *time.Location) map[onCallTimeKey]float64 {
+	ret := map[onCallTimeKey]float64{}
+
+	// business hours are validated by validateOnCallAccounting (on startup and config reload)
+	businessHours, _ := parseHourWindow(opts.PagerDuty.Schedule.BusinessHours)
+
+	for _, interval := range intervals {
+		current := interval.start.In(location)
+		for current.Before(interval.end) {
+			next := onCallNextBoundary(current, businessHours)
+			if next.After(interval.end) {
+				next = interval.end
+			}
+
+			key := onCallTimeKey{dayType: onCallDayType(opts, current), hours: OnCallHoursOff}
+			if businessHours != nil && businessHours.contains(current) {
+				key.hours = OnCallHoursBusiness
+			}
+			ret[key] += next.Sub(current).Seconds()
+
+			current = next.In(location)
+		}
+	}
+
+	return ret
+}
+
+// onCallNextBoundary returns the next change of the classification (midnight or start/end of the business hours)
+func onCallNextBoundary(t time.Time, businessHours *hourWindow) time.Time {
+	year, month, day := t.Date()
+	location := t.Location()
+
+	next := time.Date(year, month, day+1, 0, 0, 0, 0, location)
+	if businessHours != nil {
+		for _, minute := range []int{businessHours.start, businessHours.end} {
+			boundary := time.Date(year, month, day, minute/60, minute%60, 0, 0, location)
+			if boundary.After(t) && boundary.Before(next) {
+				next = boundary
+			}
+		}
+	}
+	return next
+}
+
+// onCallDayType returns the day type of the (local) time
+func onCallDayType(opts *config.Opts, t time.Time) string {
+	if slices.ContainsFunc(opts.PagerDuty.Schedule.Holidays, func(holiday string) bool {
+		return strings.TrimSpace(holiday) == t.Format(onCallHolidayFormat)
+	}) {
+		return OnCallDayTypeHoliday
+	}
+
+	if slices.Contains(opts.PagerDuty.Schedule.WeekendDays, strings.ToLower(t.Weekday().String())) {
+		return OnCallDayTypeWeekend
+	}
+
+	return OnCallDayTypeWeekday
+}
@@ -0,0 +1,495 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/webdevops/pagerduty-exporter/config"
+)
+
+func mustParseTime(t *testing.T, value string) time.Time {
+	t.Helper()
+
+	ret, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t.Fatalf("invalid time %q: %v", value, err)
+	}
+	return ret
+}
+
+func newOnCallInterval(t *testing.T, start, end string) onCallInterval {
+	t.Helper()
+	return onCallInterval{start: mustParseTime(t, start), end: mustParseTime(t, end)}
+}
+
+func TestMergeOnCallIntervals(t *testing.T) {
+	tests := []struct {
+		name      string
+		intervals [][2]string
+		since     string
+		until     string
+		expected  [][2]string
+	}{
+		{
+			name:     "empty",
+			since:    "2024-03-04T00:00:00Z",
+			until:    "2024-03-05T00:00:00Z",
+			expected: [][2]string{},
+		},
+		{
+			name: "overlapping",
+			intervals: [][2]string{
+				{"2024-03-04T08:00:00Z", "2024-03-04T12:00:00Z"},
+				{"2024-03-04T10:00:00Z", "2024-03-04T14:00:00Z"},
+				{"2024-03-04T09:00:00Z", "2024-03-04T11:00:00Z"},
+			},
+			since: "2024-03-04T00:00:00Z",
+			until: "2024-03-05T00:00:00Z",
+			expected: [][2]string{
+				{"2024-03-04T08:00:00Z", "2024-03-04T14:00:00Z"},
+			},
+		},
+		{
+			name: "adjacent",
+			intervals: [][2]string{
+				{"2024-03-04T12:00:00Z", "2024-03-04T16:00:00Z"},
+				{"2024-03-04T08:00:00Z", "2024-03-04T12:00:00Z"},
+			},
+			since: "2024-03-04T00:00:00Z",
+			until: "2024-03-05T00:00:00Z",
+			expected: [][2]string{
+				{"2024-03-04T08:00:00Z", "2024-03-04T16:00:00Z"},
+			},
+		},
+		{
+			name: "separate",
+			intervals: [][2]string{
+				{"2024-03-04T14:00:00Z", "2024-03-04T16:00:00Z"},
+				{"2024-03-04T08:00:00Z", "2024-03-04T12:00:00Z"},
+			},
+			since: "2024-03-04T00:00:00Z",
+			until: "2024-03-05T00:00:00Z",
+			expected: [][2]string{
+				{"2024-03-04T08:00:00Z", "2024-03-04T12:00:00Z"},
+				{"2024-03-04T14:00:00Z", "2024-03-04T16:00:00Z"},
+			},
+		},
+		{
+			name: "clipped to timeframe",
+			intervals: [][2]string{
+				{"2024-03-03T20:00:00Z", "2024-03-04T02:00:00Z"},
+				{"2024-03-04T22:00:00Z", "2024-03-05T04:00:00Z"},
+				{"2024-03-05T04:00:00Z", "2024-03-05T08:00:00Z"},
+			},
+			since: "2024-03-04T00:00:00Z",
+			until: "2024-03-05T00:00:00Z",
+			expected: [][2]string{
+				{"2024-03-04T00:00:00Z", "2024-03-04T02:00:00Z"},
+				{"2024-03-04T22:00:00Z", "2024-03-05T00:00:00Z"},
+			},
+		},
+		{
+			name: "empty intervals are dropped",
+			intervals: [][2]string{
+				{"2024-03-04T08:00:00Z", "2024-03-04T08:00:00Z"},
+				{"2024-03-04T12:00:00Z", "2024-03-04T10:00:00Z"},
+			},
+			since:    "2024-03-04T00:00:00Z",
+			until:    "2024-03-05T00:00:00Z",
+			expected: [][2]string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			intervals := []onCallInterval{}
+			for _, interval := range test.intervals {
+				intervals = append(intervals, newOnCallInterval(t, interval[0], interval[1]))
+			}
+
+			result := mergeOnCallIntervals(intervals, mustParseTime(t, test.since), mustParseTime(t, test.until))
+			if len(result) != len(test.expected) {
+				t.Fatalf("expected %d intervals, got %d: %v", len(test.expected), len(result), result)
+			}
+			for i, expected := range test.expected {
+				expectedInterval := newOnCallInterval(t, expected[0], expected[1])
+				if !result[i].start.Equal(expectedInterval.start) || !result[i].end.Equal(expectedInterval.end) {
+					t.Errorf("interval %d: expected %v - %v, got %v - %v", i, expectedInterval.start, expectedInterval.end, result[i].start, result[i].end)
+				}
+			}
+		})
+	}
+}
+
+func TestSplitOnCallTime(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatalf("unable to load time zone: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		intervals     [][2]string
+		location      *time.Location
+		businessHours string
+		holidays      []string
+		expected      map[onCallTimeKey]float64
+	}{
+		{
+			name:          "weekday",
+			intervals:     [][2]string{{"2024-03-04T08:00:00Z", "2024-03-04T18:00:00Z"}},
+			location:      time.UTC,
+			businessHours: "09:00-17:00",
+			expected: map[onCallTimeKey]float64{
+				{dayType: OnCallDayTypeWeekday, hours: OnCallHoursBusiness}: 8 * 3600,
+				{dayType: OnCallDayTypeWeekday, hours: OnCallHoursOff}:      2 * 3600,
+			},
+		},
+		{
+			name:          "weekend",
+			intervals:     [][2]string{{"2024-03-02T00:00:00Z", "2024-03-04T00:00:00Z"}},
+			location:      time.UTC,
+			businessHours: "09:00-17:00",
+			expected: map[onCallTimeKey]float64{
+				{dayType: OnCallDayTypeWeekend, hours: OnCallHoursBusiness}: 16 * 3600,
+				{dayType: OnCallDayTypeWeekend, hours: OnCallHoursOff}:      32 * 3600,
+			},
+		},
+		{
+			name:          "friday to monday",
+			intervals:     [][2]string{{"2024-03-01T16:00:00Z", "2024-03-04T10:00:00Z"}},
+			location:      time.UTC,
+			businessHours: "09:00-17:00",
+			expected: map[onCallTimeKey]float64{
+				{dayType: OnCallDayTypeWeekday, hours: OnCallHoursBusiness}: 2 * 3600,
+				{dayType: OnCallDayTypeWeekday, hours: OnCallHoursOff}:      (7 + 9) * 3600,
+				{dayType: OnCallDayTypeWeekend, hours: OnCallHoursBusiness}: 16 * 3600,
+				{dayType: OnCallDayTypeWeekend, hours: OnCallHoursOff}:      32 * 3600,
+			},
+		},
+		{
+			name: "dst day (23 hours)",
+			// 2024-03-31 00:00 CET until 2024-04-01 00:00 CEST
+			intervals:     [][2]string{{"2024-03-30T23:00:00Z", "2024-03-31T22:00:00Z"}},
+			location:      berlin,
+			businessHours: "09:00-17:00",
+			holidays:      []string{"2024-03-31"},
+			expected: map[onCallTimeKey]float64{
+				{dayType: OnCallDayTypeHoliday, hours: OnCallHoursBusiness}: 8 * 3600,
+				{dayType: OnCallDayTypeHoliday, hours: OnCallHoursOff}:      15 * 3600,
+			},
+		},
+		{
+			name:          "cross-midnight business hours",
+			intervals:     [][2]string{{"2024-03-05T20:00:00Z", "2024-03-06T08:00:00Z"}},
+			location:      time.UTC,
+			businessHours: "22:00-06:00",
+			expected: map[onCallTimeKey]float64{
+				{dayType: OnCallDayTypeWeekday, hours: OnCallHoursBusiness}: 8 * 3600,
+				{dayType: OnCallDayTypeWeekday, hours: OnCallHoursOff}:      4 * 3600,
+			},
+		},
+		{
+			name:          "time zone of the schedule",
+			intervals:     [][2]string{{"2024-03-04T07:00:00Z", "2024-03-04T17:00:00Z"}},
+			location:      berlin,
+			businessHours: "09:00-17:00",
+			expected: map[onCallTimeKey]float64{
+				{dayType: OnCallDayTypeWeekday, hours: OnCallHoursBusiness}: 8 * 3600,
+				{dayType: OnCallDayTypeWeekday, hours: OnCallHoursOff}:      2 * 3600,
+			},
+		},
+		{
+			name:          "multiple intervals",
+			intervals:     [][2]string{{"2024-03-04T08:00:00Z", "2024-03-04T10:00:00Z"}, {"2024-03-04T16:00:00Z", "2024-03-04T18:00:00Z"}},
+			location:      time.UTC,
+			businessHours: "09:00-17:00",
+			expected: map[onCallTimeKey]float64{
+				{dayType: OnCallDayTypeWeekday, hours: OnCallHoursBusiness}: 2 * 3600,
+				{dayType: OnCallDayTypeWeekday, hours: OnCallHoursOff}:      2 * 3600,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := &config.Opts{}
+			opts.PagerDuty.Schedule.BusinessHours = test.businessHours
+			opts.PagerDuty.Schedule.WeekendDays = []string{"saturday", "sunday"}
+			opts.PagerDuty.Schedule.Holidays = test.holidays
+
+			intervals := []onCallInterval{}
+			for _, interval := range test.intervals {
+				intervals = append(intervals, newOnCallInterval(t, interval[0], interval[1]))
+			}
+
+			result := splitOnCallTime(opts, intervals, test.location)
+			if len(result) != len(test.expected) {
+				t.Fatalf("expected %v, got %v", test.expected, result)
+			}
+			for key, expected := range test.expected {
+				if result[key] != expected {
+					t.Errorf("%v: expected %v seconds, got %v seconds", key, expected, result[key])
+				}
+			}
+		})
+	}
+}
+
+func TestOnCallGaps(t *testing.T) {
+	tests := []struct {
+		name      string
+		intervals [][2]string
+		since     string
+		until     string
+		expected  [][2]string
+	}{
+		{
+			name:  "nobody oncall",
+			since: "2024-03-04T00:00:00Z",
+			until: "2024-03-05T00:00:00Z",
+			expected: [][2]string{
+				{"2024-03-04T00:00:00Z", "2024-03-05T00:00:00Z"},
+			},
+		},
+		{
+			name: "fully covered",
+			intervals: [][2]string{
+				{"2024-03-03T20:00:00Z", "2024-03-04T12:00:00Z"},
+				{"2024-03-04T12:00:00Z", "2024-03-05T08:00:00Z"},
+			},
+			since:    "2024-03-04T00:00:00Z",
+			until:    "2024-03-05T00:00:00Z",
+			expected: [][2]string{},
+		},
+		{
+			name: "overlapping entries without gap",
+			intervals: [][2]string{
+				{"2024-03-04T00:00:00Z", "2024-03-04T14:00:00Z"},
+				{"2024-03-04T10:00:00Z", "2024-03-05T00:00:00Z"},
+			},
+			since:    "2024-03-04T00:00:00Z",
+			until:    "2024-03-05T00:00:00Z",
+			expected: [][2]string{},
+		},
+		{
+			name: "gaps at start, middle and end",
+			intervals: [][2]string{
+				{"2024-03-04T14:00:00Z", "2024-03-04T20:00:00Z"},
+				{"2024-03-04T02:00:00Z", "2024-03-04T10:00:00Z"},
+			},
+			since: "2024-03-04T00:00:00Z",
+			until: "2024-03-05T00:00:00Z",
+			expected: [][2]string{
+				{"2024-03-04T00:00:00Z", "2024-03-04T02:00:00Z"},
+				{"2024-03-04T10:00:00Z", "2024-03-04T14:00:00Z"},
+				{"2024-03-04T20:00:00Z", "2024-03-05T00:00:00Z"},
+			},
+		},
+		{
+			name: "entries outside of the timeframe",
+			intervals: [][2]string{
+				{"2024-03-03T00:00:00Z", "2024-03-04T00:00:00Z"},
+				{"2024-03-05T00:00:00Z", "2024-03-06T00:00:00Z"},
+			},
+			since: "2024-03-04T00:00:00Z",
+			until: "2024-03-05T00:00:00Z",
+			expected: [][2]string{
+				{"2024-03-04T00:00:00Z", "2024-03-05T00:00:00Z"},
+			},
+		},
+		{
+			name: "ongoing gap started before the timeframe",
+			intervals: [][2]string{
+				{"2024-03-04T06:00:00Z", "2024-03-05T00:00:00Z"},
+			},
+			since: "2024-03-04T00:00:00Z",
+			until: "2024-03-05T00:00:00Z",
+			expected: [][2]string{
+				{"2024-03-04T00:00:00Z", "2024-03-04T06:00:00Z"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			intervals := []onCallInterval{}
+			for _, interval := range test.intervals {
+				intervals = append(intervals, newOnCallInterval(t, interval[0], interval[1]))
+			}
+
+			result := onCallGaps(intervals, mustParseTime(t, test.since), mustParseTime(t, test.until))
+			if len(result) != len(test.expected) {
+				t.Fatalf("expected %d gaps, got %d: %v", len(test.expected), len(result), result)
+			}
+			for i, expected := range test.expected {
+				expectedGap := newOnCallInterval(t, expected[0], expected[1])
+				if !result[i].start.Equal(expectedGap.start) || !result[i].end.Equal(expectedGap.end) {
+					t.Errorf("gap %d: expected %v - %v, got %v - %v", i, expectedGap.start, expectedGap.end, result[i].start, result[i].end)
+				}
+			}
+		})
+	}
+}
+
+func TestScheduleGaps(t *testing.T) {
+	since := "2024-03-03T12:00:00Z"
+	now := "2024-03-04T12:00:00Z"
+	until := "2024-03-05T12:00:00Z"
+
+	tests := []struct {
+		name      string
+		intervals [][2]string
+		expected  []scheduleGap
+		nextGap   float64
+		uncovered float64
+	}{
+		{
+			name: "covered",
+			intervals: [][2]string{
+				{"2024-03-03T00:00:00Z", "2024-03-06T00:00:00Z"},
+			},
+			expected: []scheduleGap{},
+		},
+		{
+			name: "past gaps are ignored",
+			intervals: [][2]string{
+				{"2024-03-03T12:00:00Z", "2024-03-03T18:00:00Z"},
+				{"2024-03-04T00:00:00Z", "2024-03-06T00:00:00Z"},
+			},
+			expected: []scheduleGap{},
+		},
+		{
+			name: "next gap",
+			intervals: [][2]string{
+				{"2024-03-03T00:00:00Z", "2024-03-04T18:00:00Z"},
+				{"2024-03-04T20:00:00Z", "2024-03-06T00:00:00Z"},
+			},
+			expected: []scheduleGap{
+				{onCallInterval: newOnCallInterval(t, "2024-03-04T18:00:00Z", "2024-03-04T20:00:00Z")},
+			},
+			nextGap:   6 * 3600,
+			uncovered: 2 * 3600,
+		},
+		{
+			name: "current gap",
+			intervals: [][2]string{
+				{"2024-03-03T00:00:00Z", "2024-03-04T10:00:00Z"},
+				{"2024-03-04T14:00:00Z", "2024-03-05T00:00:00Z"},
+			},
+			expected: []scheduleGap{
+				{onCallInterval: newOnCallInterval(t, "2024-03-04T10:00:00Z", "2024-03-04T14:00:00Z"), current: true},
+				{onCallInterval: newOnCallInterval(t, "2024-03-05T00:00:00Z", "2024-03-05T12:00:00Z")},
+			},
+			nextGap:   0,
+			uncovered: (2 + 12) * 3600,
+		},
+		{
+			name: "current gap started at now",
+			intervals: [][2]string{
+				{"2024-03-03T00:00:00Z", "2024-03-04T12:00:00Z"},
+				{"2024-03-04T14:00:00Z", "2024-03-06T00:00:00Z"},
+			},
+			expected: []scheduleGap{
+				{onCallInterval: newOnCallInterval(t, "2024-03-04T12:00:00Z", "2024-03-04T14:00:00Z"), current: true},
+			},
+			nextGap:   0,
+			uncovered: 2 * 3600,
+		},
+		{
+			name: "current gap started before the timeframe is clipped",
+			intervals: [][2]string{
+				{"2024-03-04T18:00:00Z", "2024-03-06T00:00:00Z"},
+			},
+			expected: []scheduleGap{
+				{onCallInterval: newOnCallInterval(t, since, "2024-03-04T18:00:00Z"), current: true},
+			},
+			nextGap:   0,
+			uncovered: 6 * 3600,
+		},
+		{
+			name: "nobody oncall",
+			expected: []scheduleGap{
+				{onCallInterval: newOnCallInterval(t, since, until), current: true},
+			},
+			nextGap:   0,
+			uncovered: 24 * 3600,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			intervals := []onCallInterval{}
+			for _, interval := range test.intervals {
+				intervals = append(intervals, newOnCallInterval(t, interval[0], interval[1]))
+			}
+
+			gaps, nextGap, uncovered := scheduleGaps(intervals, mustParseTime(t, since), mustParseTime(t, until), mustParseTime(t, now))
+			if len(gaps) != len(test.expected) {
+				t.Fatalf("expected %d gaps, got %d: %v", len(test.expected), len(gaps), gaps)
+			}
+			for i, expected := range test.expected {
+				if !gaps[i].start.Equal(expected.start) || !gaps[i].end.Equal(expected.end) || gaps[i].current != expected.current {
+					t.Errorf("gap %d: expected %v - %v (current %v), got %v - %v (current %v)", i, expected.start, expected.end, expected.current, gaps[i].start, gaps[i].end, gaps[i].current)
+				}
+			}
+
+			if len(gaps) > 0 && nextGap != test.nextGap {
+				t.Errorf("expected next gap in %v seconds, got %v", test.nextGap, nextGap)
+			}
+			if uncovered != test.uncovered {
+				t.Errorf("expected %v uncovered seconds, got %v", test.uncovered, uncovered)
+			}
+		})
+	}
+}
+
+func TestOnCallCoverage(t *testing.T) {
+	tests := []struct {
+		name      string
+		intervals [][2]string
+		expected  float64
+	}{
+		{
+			name:     "nobody oncall",
+			expected: 0,
+		},
+		{
+			name: "fully covered",
+			intervals: [][2]string{
+				{"2024-03-03T00:00:00Z", "2024-03-06T00:00:00Z"},
+			},
+			expected: 100,
+		},
+		{
+			name: "entries outside of the timeframe are ignored",
+			intervals: [][2]string{
+				{"2024-03-03T00:00:00Z", "2024-03-04T06:00:00Z"},
+				{"2024-03-04T18:00:00Z", "2024-03-06T00:00:00Z"},
+			},
+			expected: 50,
+		},
+		{
+			name: "overlapping entries are counted once",
+			intervals: [][2]string{
+				{"2024-03-04T00:00:00Z", "2024-03-04T06:00:00Z"},
+				{"2024-03-04T00:00:00Z", "2024-03-04T06:00:00Z"},
+			},
+			expected: 25,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			intervals := []onCallInterval{}
+			for _, interval := range test.intervals {
+				intervals = append(intervals, newOnCallInterval(t, interval[0], interval[1]))
+			}
+
+			coverage := onCallCoverage(intervals, mustParseTime(t, "2024-03-04T00:00:00Z"), mustParseTime(t, "2024-03-05T00:00:00Z"))
+			if coverage != test.expected {
+				t.Errorf("expected coverage %v, got %v", test.expected, coverage)
+			}
+		})
+	}
+}
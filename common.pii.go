@@ -0,0 +1,84 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/PagerDuty/go-pagerduty"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/webdevops/pagerduty-exporter/config"
+)
+
+const (
+	PiiPolicyKeep   = "keep"
+	PiiPolicyDrop   = "drop"
+	PiiPolicyHash   = "hash"
+	PiiPolicyDomain = "domain"
+
+	// length of the pseudonyms (bytes of the HMAC, hex encoded)
+	piiHashLength = 16
+)
+
+// loadPiiHashKey loads the hash key file and ensures a hash key is set if a field is pseudonymized
+func loadPiiHashKey(opts *config.Opts) error {
+	pii := &opts.PagerDuty.Pii
+
+	if pii.HashKeyFile != "" {
+		data, err := os.ReadFile(pii.HashKeyFile)
+		if err != nil {
+			return fmt.Errorf(`failed to read PII hash key from file: %w`, err)
+		}
+		pii.HashKey = strings.TrimSpace(string(data))
+	}
+
+	for _, policy := range []string{pii.UserName, pii.UserMail, pii.UserAvatar, pii.UserJobTitle} {
+		if policy == PiiPolicyHash && pii.HashKey == "" {
+			return errors.New(`PII policy "hash" requires a hash key (--pagerduty.pii.hash-key or --pagerduty.pii.hash-key-file)`)
+		}
+	}
+
+	return nil
+}
+
+// piiValue applies the PII policy to a value, empty values are kept empty
+func piiValue(policy, value, hashKey string) string {
+	if value == "" {
+		return value
+	}
+
+	switch policy {
+	case PiiPolicyDrop:
+		return ""
+	case PiiPolicyHash:
+		mac := hmac.New(sha256.New, []byte(hashKey))
+		mac.Write([]byte(value))
+		return hex.EncodeToString(mac.Sum(nil)[:piiHashLength])
+	case PiiPolicyDomain:
+		if _, domain, found := strings.Cut(value, "@"); found {
+			return domain
+		}
+		return ""
+	default:
+		return value
+	}
+}
+
+// piiUserLabels returns the identity labels of the user with the PII policies applied,
+// userID is always kept as join key for all other user related metrics
+func piiUserLabels(opts *config.Opts, user pagerduty.User) prometheus.Labels {
+	pii := opts.PagerDuty.Pii
+
+	return prometheus.Labels{
+		"userID":       user.ID,
+		"userName":     piiValue(pii.UserName, user.Name, pii.HashKey),
+		"userMail":     piiValue(pii.UserMail, user.Email, pii.HashKey),
+		"userAvatar":   piiValue(pii.UserAvatar, user.AvatarURL, pii.HashKey),
+		"userJobTitle": piiValue(pii.UserJobTitle, user.JobTitle, pii.HashKey),
+	}
+}
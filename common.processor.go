@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"github.com/PagerDuty/go-pagerduty"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/webdevops/go-common/prometheus/collector"
+
+	"github.com/webdevops/pagerduty-exporter/config"
+)
+
+// PagerDutyProcessor is the common base of all PagerDuty collectors, it handles
+// classified errors of PagerDuty API calls and tracks the status of the runs
+type PagerDutyProcessor struct {
+	collector.Processor
+
+	account    *PagerDutyAccount
+	scrapeTime func(opts *config.Opts) time.Duration
+	status     *collectorStatus
+
+	// config and account settings of the current run (snapshot, not changed by config reloads)
+	opts     *config.Opts
+	settings *pagerDutyAccountSettings
+
+	// context of the runs, passes the status to the PagerDuty transport
+	runContext context.Context
+
+	// names and vectors of the registered metric lists
+	metricLists []string
+	metricVecs  map[string]interface{}
+
+	// exported series of the counters which are never reset (for the series limit)
+	counterSeries map[string]map[string]bool
+
+	runErrors int64
+}
+
+func newPagerDutyProcessor(account *PagerDutyAccount, name string, scrapeTime func(opts *config.Opts) time.Duration) PagerDutyProcessor {
+	return PagerDutyProcessor{
+		account:    account,
+		scrapeTime: scrapeTime,
+		status:     newCollectorStatus(account.Name, name),
+		opts:       currentConfig(),
+		settings:   account.currentSettings(),
+	}
+}
+
+// client returns the PagerDuty client of the account (of the current run)
+func (p *PagerDutyProcessor) client() *pagerduty.Client {
+	return p.settings.Client
+}
+
+// teamListOpt returns the team filter of the account (of the current run)
+func (p *PagerDutyProcessor) teamListOpt() []string {
+	return p.settings.TeamFilter
+}
+
+// Context returns the context of the collector runs, waits of PagerDuty API requests using this context
+// are not counted as stuck run by the liveness check
+func (p *PagerDutyProcessor) Context() context.Context {
+	if p.runContext == nil {
+		return p.Processor.Context()
+	}
+	return p.runContext
+}
+
+// constLabels returns the labels which are added to all metrics of the collector
+func (p *PagerDutyProcessor) constLabels() prometheus.Labels {
+	return p.account.constLabels()
+}
+
+// handleError classifies, counts and logs a failed PagerDuty API call and returns the classified error
+func (p *PagerDutyProcessor) handleError(endpoint string, err error) error {
+	collectorErr := NewCollectorError(endpoint, err)
+
+	PrometheusCollectorErrors.WithLabelValues(p.account.Name, p.Collector.Name, endpoint, string(collectorErr.Class)).Inc()
+
+	if collectorErr.Class == ErrorClassNotFound {
+		// object vanished or feature is not available in the current plan
+		p.Logger().Info("PagerDuty API object not found or not available", slog.String("endpoint", endpoint), slog.Any("error", err))
+	} else {
+		atomic.AddInt64(&p.runErrors, 1)
+		p.status.apiError(collectorErr)
+		p.Logger().Warn("PagerDuty API call failed", slog.String("endpoint", endpoint), slog.String("class", string(collectorErr.Class)), slog.Any("error", err))
+	}
+
+	return collectorErr
+}
+
+// run executes the collect function of the collector; runs without errors update the last success
+// timestamp, runs which failed are passed to the collector as panic so it can back off and
+// won't persist the (incomplete) metrics in the cache (panic threshold of the collectors is disabled,
+// so failed runs never stop the exporter)
+func (p *PagerDutyProcessor) run(collect func() error) {
+	// config reloads are applied on the next run, no lock is held while collecting
+	p.opts = currentConfig()
+	p.settings = p.account.currentSettings()
+
+	if p.runContext == nil {
+		p.runContext = contextWithCollectorStatus(p.Processor.Context(), p.status)
+	}
+
+	atomic.StoreInt64(&p.runErrors, 0)
+
+	// scrape time might have been changed by a config reload
+	var scrapeTime time.Duration
+	if p.scrapeTime != nil {
+		if scrapeTime = p.scrapeTime(p.opts); scrapeTime > 0 {
+			p.Collector.SetNextSleepDuration(scrapeTime)
+		}
+	}
+
+	// runErr stays set if collect panics
+	runErr := errCollectorPanic
+	p.status.runStarted(scrapeTime)
+	defer func() {
+		p.status.runFinished(runErr, atomic.LoadInt64(&p.runErrors) == 0)
+	}()
+
+	// collector exports the metric lists of failed (panicked) runs too, so the guardrails are
+	// applied to the partial metrics as well
+	defer p.applyMetricGuardrails()
+
+	err := collect()
+
+	var collectorErr *CollectorError
+	if errors.As(err, &collectorErr) && collectorErr.Class == ErrorClassNotFound {
+		// nothing to collect, not a failure
+		err = nil
+	}
+
+	runErr = err
+	if err != nil {
+		panic(err)
+	}
+
+	if atomic.LoadInt64(&p.runErrors) == 0 {
+		PrometheusCollectorLastSuccess.WithLabelValues(p.account.Name, p.Collector.Name).SetToCurrentTime()
+	}
+}
+
+// Reset is called after each run, before the metrics restored from cache are set and again if setting
+// the restored metrics failed; only calls before the first run are cache restores
+func (p *PagerDutyProcessor) Reset() {
+	if p.status.hasRun() {
+		return
+	}
+	p.status.cacheRestored(p.validRestoredMetrics())
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/webdevops/go-common/prometheus/collector"
+
+	"github.com/webdevops/pagerduty-exporter/config"
+)
+
+type testGuardrailsCollector struct {
+	PagerDutyProcessor
+}
+
+var (
+	testGuardrailsProcessor     *testGuardrailsCollector
+	testGuardrailsProcessorOnce sync.Once
+
+	testGuardrailsMetrics = []string{
+		"pagerduty_test_guardrails_labels",
+		"pagerduty_test_guardrails_limited",
+		"pagerduty_test_guardrails_disabled",
+	}
+)
+
+func (m *testGuardrailsCollector) Setup(collector *collector.Collector) {
+	m.Processor.Setup(collector)
+
+	for _, name := range testGuardrailsMetrics {
+		m.registerMetricList(name, prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: name}, []string{"incidentID", "teamID"}), true)
+	}
+}
+
+func (m *testGuardrailsCollector) Collect(callback chan<- func()) {}
+
+// newTestGuardrailsProcessor returns a processor with test metric lists, the collector (and its metrics)
+// are registered only once per test binary
+func newTestGuardrailsProcessor(t *testing.T, opts *config.Opts) *testGuardrailsCollector {
+	t.Helper()
+
+	testGuardrailsProcessorOnce.Do(func() {
+		if PrometheusCollectorLastSuccess == nil {
+			initMetricCollector()
+		}
+		if PrometheusSeriesDropped == nil {
+			initMetricGuardrails()
+		}
+
+		account := &PagerDutyAccount{Name: "test"}
+		account.applyConfig(config.PagerDutyAccount{Name: "test"})
+
+		testGuardrailsProcessor = &testGuardrailsCollector{PagerDutyProcessor: newPagerDutyProcessor(account, "Guardrails", nil)}
+		collector.New("test-guardrails", testGuardrailsProcessor, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	})
+
+	currentOpts.Store(opts)
+	t.Cleanup(func() {
+		currentOpts.Store(nil)
+	})
+
+	return testGuardrailsProcessor
+}
+
+func TestRunMetricGuardrails(t *testing.T) {
+	maxSeries := 1
+
+	opts := &config.Opts{}
+	opts.Metrics.Families = map[string]config.MetricFamily{
+		"pagerduty_test_guardrails_labels":   {DropLabels: []string{"teamID"}},
+		"pagerduty_test_guardrails_limited":  {MaxSeries: &maxSeries},
+		"pagerduty_test_guardrails_disabled": {Disabled: true},
+	}
+
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{
+			name: "successful run",
+		},
+		{
+			name: "failed run",
+			err:  errors.New("ListIncidents failed"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := newTestGuardrailsProcessor(t, opts)
+
+			panicked := func() (panicked bool) {
+				defer func() {
+					panicked = recover() != nil
+				}()
+
+				p.run(func() error {
+					for _, name := range testGuardrailsMetrics {
+						metricList := p.Collector.GetMetricList(name)
+						metricList.Reset()
+						metricList.AddInfo(prometheus.Labels{"incidentID": "P1", "teamID": "T1"})
+						metricList.AddInfo(prometheus.Labels{"incidentID": "P2", "teamID": "T2"})
+					}
+					return test.err
+				})
+				return false
+			}()
+			if expected := test.err != nil; panicked != expected {
+				t.Fatalf("expected panic: %v, got %v", expected, panicked)
+			}
+
+			for _, row := range p.Collector.GetMetricList("pagerduty_test_guardrails_labels").GetList() {
+				if row.Labels["teamID"] != "" {
+					t.Errorf("expected dropped teamID label, got %q", row.Labels["teamID"])
+				}
+			}
+
+			if rows := len(p.Collector.GetMetricList("pagerduty_test_guardrails_limited").GetList()); rows != maxSeries {
+				t.Errorf("expected %d series of the limited metric, got %d", maxSeries, rows)
+			}
+
+			if rows := len(p.Collector.GetMetricList("pagerduty_test_guardrails_disabled").GetList()); rows != 0 {
+				t.Errorf("expected no series of the disabled metric, got %d", rows)
+			}
+		})
+	}
+}
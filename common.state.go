@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	corev1apply "k8s.io/client-go/applyconfigurations/core/v1"
+	"k8s.io/client-go/kubernetes"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/rest"
+
+	"github.com/webdevops/go-common/azuresdk/armclient"
+)
+
+const (
+	stateProtocolFile         = "file"
+	stateProtocolAzBlob       = "azblob"
+	stateProtocolK8sConfigMap = "k8scm"
+)
+
+type (
+	// stateFile persists collector state (eg. high-water marks) next to the collector caches,
+	// supports the same backends as the cache (path, file://path, azblob:// and k8scm://)
+	stateFile struct {
+		raw      string
+		protocol string
+
+		// file
+		path string
+
+		// azblob
+		azblobClient    *azblob.Client
+		azblobContainer string
+		azblobBlob      string
+
+		// k8scm
+		configMapClient    corev1.CoreV1Interface
+		configMapNamespace string
+		configMapName      string
+		configMapKey       string
+	}
+)
+
+// newStateFile returns the state file for name inside the cache path, or nil if no cache path is configured
+func newStateFile(name string) (*stateFile, error) {
+	cachePath := Opts.GetCachePath(name)
+	if cachePath == nil {
+		return nil, nil
+	}
+
+	rawSpec := *cachePath
+	s := &stateFile{raw: rawSpec}
+
+	switch {
+	case strings.HasPrefix(rawSpec, "azblob://"):
+		s.protocol = stateProtocolAzBlob
+		parsedUrl, err := url.Parse(rawSpec)
+		if err != nil {
+			return nil, err
+		}
+
+		pathParts := strings.SplitN(strings.TrimPrefix(parsedUrl.Path, "/"), "/", 2)
+		if len(pathParts) < 2 || pathParts[0] == "" || pathParts[1] == "" {
+			return nil, fmt.Errorf(`azblob path needs to be specified as azblob://storageaccount.blob.core.windows.net/container/blob, got: %v`, rawSpec)
+		}
+		s.azblobContainer = pathParts[0]
+		s.azblobBlob = pathParts[1]
+
+		azureClient, err := armclient.NewArmClientFromEnvironment(logger.Slog())
+		if err != nil {
+			return nil, err
+		}
+
+		azblobOpts := azblob.ClientOptions{ClientOptions: *azureClient.NewAzCoreClientOptions()}
+		s.azblobClient, err = azblob.NewClient(fmt.Sprintf(`https://%v/`, parsedUrl.Hostname()), azureClient.GetCred(), &azblobOpts)
+		if err != nil {
+			return nil, err
+		}
+	case strings.HasPrefix(rawSpec, "k8scm://"):
+		s.protocol = stateProtocolK8sConfigMap
+		parsedUrl, err := url.Parse(rawSpec)
+		if err != nil {
+			return nil, err
+		}
+
+		// path begins with a slash, the first part is always empty
+		pathParts := strings.SplitN(parsedUrl.Path, "/", 3)
+		if len(pathParts) < 3 {
+			return nil, fmt.Errorf(`k8scm path needs to be specified as k8scm://namespace/name, got: %v`, rawSpec)
+		}
+		s.configMapNamespace = parsedUrl.Hostname()
+		s.configMapName = pathParts[1]
+		// slashes are not allowed as key
+		s.configMapKey = strings.ReplaceAll(pathParts[2], "/", "-")
+
+		config, err := rest.InClusterConfig()
+		if err != nil {
+			return nil, err
+		}
+		client, err := kubernetes.NewForConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		s.configMapClient = client.CoreV1()
+	default:
+		s.protocol = stateProtocolFile
+		s.path = strings.TrimPrefix(rawSpec, "file://")
+	}
+
+	return s, nil
+}
+
+// Load reads the state into v, returns false if there is no (valid) state
+func (s *stateFile) Load(v interface{}) bool {
+	if s == nil {
+		return false
+	}
+
+	content, exists, err := s.read()
+	if err != nil {
+		logger.Warn("unable to read state", slog.String("state", s.raw), slog.Any("error", err))
+		return false
+	}
+	if !exists {
+		return false
+	}
+
+	if err := json.Unmarshal(content, v); err != nil {
+		logger.Warn("unable to decode state", slog.String("state", s.raw), slog.Any("error", err))
+		return false
+	}
+
+	return true
+}
+
+// Save writes v to the state file (atomically for local files)
+func (s *stateFile) Save(v interface{}) error {
+	if s == nil {
+		return nil
+	}
+
+	content, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf(`failed to serialize state: %w`, err)
+	}
+
+	return s.write(content)
+}
+
+// read returns the content of the state file, exists is false if there is no state yet
+func (s *stateFile) read() (content []byte, exists bool, err error) {
+	switch s.protocol {
+	case stateProtocolAzBlob:
+		response, err := s.azblobClient.DownloadStream(context.Background(), s.azblobContainer, s.azblobBlob, nil)
+		if err != nil {
+			if bloberror.HasCode(err, bloberror.BlobNotFound, bloberror.ContainerNotFound) {
+				return nil, false, nil
+			}
+			return nil, false, err
+		}
+		defer response.Body.Close() // nolint: errcheck
+
+		content, err = io.ReadAll(response.Body)
+		return content, err == nil, err
+	case stateProtocolK8sConfigMap:
+		configMap, err := s.configMapClient.ConfigMaps(s.configMapNamespace).Get(context.Background(), s.configMapName, metav1.GetOptions{})
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil, false, nil
+			}
+			return nil, false, err
+		}
+
+		data, ok := configMap.BinaryData[s.configMapKey]
+		if !ok {
+			return nil, false, nil
+		}
+
+		// configmaps are limited to 1MB, the state is stored compressed
+		reader, err := gzip.NewReader(base64.NewDecoder(base64.StdEncoding, bytes.NewReader(data)))
+		if err != nil {
+			return nil, false, err
+		}
+
+		content, err = io.ReadAll(reader)
+		return content, err == nil, err
+	default:
+		content, err = os.ReadFile(s.path) // #nosec inside container
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil, false, nil
+			}
+			return nil, false, err
+		}
+		return content, true, nil
+	}
+}
+
+// write stores the content in the state file
+func (s *stateFile) write(content []byte) error {
+	switch s.protocol {
+	case stateProtocolAzBlob:
+		_, err := s.azblobClient.UploadBuffer(context.Background(), s.azblobContainer, s.azblobBlob, content, nil)
+		return err
+	case stateProtocolK8sConfigMap:
+		// configmaps are limited to 1MB, the state is stored compressed
+		var buf64 bytes.Buffer
+		wb64 := base64.NewEncoder(base64.StdEncoding, &buf64)
+		wgz := gzip.NewWriter(wb64)
+		if _, err := wgz.Write(content); err != nil {
+			return err
+		}
+		if err := wgz.Close(); err != nil {
+			return err
+		}
+		if err := wb64.Close(); err != nil {
+			return err
+		}
+
+		configMap := corev1apply.ConfigMap(s.configMapName, s.configMapNamespace)
+		configMap.WithBinaryData(map[string][]byte{s.configMapKey: buf64.Bytes()})
+
+		_, err := s.configMapClient.ConfigMaps(s.configMapNamespace).Apply(
+			context.Background(),
+			configMap,
+			metav1.ApplyOptions{FieldManager: "pagerduty-exporter/" + s.configMapKey},
+		)
+		if err != nil {
+			return fmt.Errorf(`unable to update kubernetes configmap: %w`, err)
+		}
+		return nil
+	default:
+		dirPath := filepath.Dir(s.path)
+		if err := os.MkdirAll(dirPath, 0700); err != nil {
+			return err
+		}
+
+		// write to temp file first and rename afterwards (atomic operation)
+		tmpFilePath := filepath.Join(dirPath, fmt.Sprintf(".%s.tmp", filepath.Base(s.path)))
+		if err := os.WriteFile(tmpFilePath, content, 0600); err != nil {
+			return err
+		}
+
+		return os.Rename(tmpFilePath, s.path)
+	}
+}
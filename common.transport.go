@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+var (
+	// collection and action names in the PagerDuty API paths are lowercase, object IDs are not
+	pagerdutyEndpointSegmentRegexp = regexp.MustCompile(`^[a-z_]+$`)
+)
+
+type (
+	// pagerdutyTransport is a rate limit aware http.RoundTripper for the PagerDuty API;
+	// it enforces a request budget shared by all collectors of an account, honours rate limit headers and retries idempotent requests
+	pagerdutyTransport struct {
+		account   string
+		transport http.RoundTripper
+		limiter   *rate.Limiter
+
+		retries    int
+		backoff    time.Duration
+		maxBackoff time.Duration
+
+		lock        sync.Mutex
+		pausedUntil time.Time
+	}
+
+	// pagerdutyInstrumentedTransport records duration and status of every PagerDuty API request
+	pagerdutyInstrumentedTransport struct {
+		account   string
+		transport http.RoundTripper
+	}
+)
+
+func (t *pagerdutyInstrumentedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	startTime := time.Now()
+	resp, err := t.transport.RoundTrip(req)
+	duration := time.Since(startTime)
+
+	statusClass := "error"
+	if err == nil {
+		statusClass = fmt.Sprintf("%dxx", resp.StatusCode/100)
+	}
+
+	endpoint := pagerdutyEndpointTemplate(req.URL.Path)
+	PrometheusPagerDutyApiRequests.WithLabelValues(t.account, endpoint, req.Method, statusClass).Inc()
+	PrometheusPagerDutyApiDuration.WithLabelValues(t.account, endpoint, req.Method, statusClass).Observe(duration.Seconds())
+
+	return resp, err
+}
+
+// pagerdutyEndpointTemplate replaces object IDs in the url path with placeholders (eg. /schedules/PXXXXXX -> /schedules/{id})
+func pagerdutyEndpointTemplate(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if segment != "" && !pagerdutyEndpointSegmentRegexp.MatchString(segment) {
+			segments[i] = "{id}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+func newPagerdutyTransport(account string, transport http.RoundTripper) *pagerdutyTransport {
+	t := &pagerdutyTransport{
+		account:    account,
+		transport:  transport,
+		limiter:    rate.NewLimiter(rate.Inf, 0),
+		retries:    Opts.PagerDuty.RateLimit.Retries,
+		backoff:    Opts.PagerDuty.RateLimit.Backoff,
+		maxBackoff: Opts.PagerDuty.RateLimit.MaxBackoff,
+	}
+
+	if Opts.PagerDuty.RateLimit.RequestsPerMinute > 0 {
+		requestsPerMinute := Opts.PagerDuty.RateLimit.RequestsPerMinute
+		t.limiter = rate.NewLimiter(rate.Limit(float64(requestsPerMinute)/60), requestsPerMinute)
+	}
+
+	return t
+}
+
+// Budget returns the currently available requests of the request budget
+func (t *pagerdutyTransport) Budget() float64 {
+	if t.limiter.Limit() == rate.Inf {
+		return -1
+	}
+	return t.limiter.Tokens()
+}
+
+func (t *pagerdutyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	retryable := req.Method == http.MethodGet || req.Method == http.MethodHead
+
+	for attempt := 0; ; attempt++ {
+		if err := t.wait(req); err != nil {
+			return nil, err
+		}
+
+		resp, err := t.transport.RoundTrip(req)
+
+		var retryAfter time.Duration
+		switch {
+		case err != nil:
+			if req.Context().Err() != nil {
+				return nil, err
+			}
+		case resp.StatusCode == http.StatusTooManyRequests:
+			PrometheusPagerDutyApiRateLimited.WithLabelValues(t.account).Inc()
+			retryAfter = min(parseRateLimitReset(resp.Header), t.maxBackoff)
+			t.pause(retryAfter)
+		case resp.StatusCode >= 500:
+		default:
+			return resp, nil
+		}
+
+		if !retryable || attempt >= t.retries {
+			return resp, err
+		}
+
+		// retry request, wait for rate limit reset or use exponential backoff
+		waitDuration := retryAfter
+		if waitDuration == 0 {
+			waitDuration = t.backoffDuration(attempt)
+		}
+
+		if resp != nil {
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+
+		PrometheusPagerDutyApiRetries.WithLabelValues(t.account).Inc()
+		logger.Debug(
+			"retrying PagerDuty API request",
+			slog.String("account", t.account),
+			slog.String("url", req.URL.String()),
+			slog.Int("attempt", attempt+1),
+			slog.Duration("wait", waitDuration),
+		)
+
+		status := collectorStatusFromContext(req.Context())
+		status.waitStarted()
+		select {
+		case <-req.Context().Done():
+			status.waitFinished()
+			return nil, req.Context().Err()
+		case <-time.After(waitDuration):
+			status.waitFinished()
+		}
+	}
+}
+
+// wait blocks until the API is not paused anymore and the request budget allows another request,
+// the wait is recorded in the status of the collector run (not counted by the liveness check)
+func (t *pagerdutyTransport) wait(req *http.Request) error {
+	status := collectorStatusFromContext(req.Context())
+	status.waitStarted()
+	defer status.waitFinished()
+
+	t.lock.Lock()
+	pauseDuration := time.Until(t.pausedUntil)
+	t.lock.Unlock()
+
+	if pauseDuration > 0 {
+		select {
+		case <-req.Context().Done():
+			return req.Context().Err()
+		case <-time.After(pauseDuration):
+		}
+	}
+
+	return t.limiter.Wait(req.Context())
+}
+
+// pause stops all requests (of all collectors of the account) until the rate limit is reset
+func (t *pagerdutyTransport) pause(duration time.Duration) {
+	if duration <= 0 {
+		return
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if pausedUntil := time.Now().Add(duration); pausedUntil.After(t.pausedUntil) {
+		t.pausedUntil = pausedUntil
+	}
+}
+
+// backoffDuration calculates the jittered exponential backoff for the retry attempt
+func (t *pagerdutyTransport) backoffDuration(attempt int) time.Duration {
+	duration := t.backoff << uint(attempt) // #nosec G115 attempt is limited by retries
+	if duration <= 0 || duration > t.maxBackoff {
+		duration = t.maxBackoff
+	}
+
+	// jitter between 50% and 100% of the backoff duration
+	return duration/2 + time.Duration(rand.Int63n(int64(duration/2)+1)) // #nosec G404 random value only used for jitter
+}
+
+// parseRateLimitReset parses the Retry-After and ratelimit-reset headers and returns the wait duration
+func parseRateLimitReset(header http.Header) (ret time.Duration) {
+	if val := header.Get("Retry-After"); val != "" {
+		if seconds, err := strconv.Atoi(val); err == nil {
+			ret = time.Duration(seconds) * time.Second
+		} else if at, err := http.ParseTime(val); err == nil {
+			ret = time.Until(at)
+		}
+	}
+
+	if val := header.Get("ratelimit-reset"); val != "" {
+		if seconds, err := strconv.Atoi(val); err == nil {
+			if reset := time.Duration(seconds) * time.Second; reset > ret {
+				ret = reset
+			}
+		}
+	}
+
+	if ret < 0 {
+		ret = 0
+	}
+
+	return
+}
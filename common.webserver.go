@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/exporter-toolkit/web"
+	"go.yaml.in/yaml/v3"
+)
+
+type (
+	// bearerTokenAuth checks the bearer token of requests against the tokens of a file,
+	// the file is read again if it has been changed
+	bearerTokenAuth struct {
+		path    string
+		handler http.Handler
+
+		lock    sync.Mutex
+		modTime time.Time
+		size    int64
+		tokens  [][sha256.Size]byte
+	}
+)
+
+// serveHTTP serves the handler with TLS and basic auth of the web config file (reloaded on change),
+// TLS client certificates and basic auth users apply to all paths
+func serveHTTP(srv *http.Server) error {
+	if err := validateWebConfig(); err != nil {
+		return err
+	}
+
+	listenAddresses := []string{Opts.Server.Bind}
+	systemdSocket := false
+	return web.ListenAndServe(srv, &web.FlagConfig{
+		WebListenAddresses: &listenAddresses,
+		WebSystemdSocket:   &systemdSocket,
+		WebConfigFile:      &Opts.Server.WebConfigFile,
+	}, logger.Slog())
+}
+
+// validateWebConfig validates the web config file (including certificates), basic auth users of the
+// web config file can't be combined with bearer tokens as both are using the Authorization header
+func validateWebConfig() error {
+	if Opts.Server.WebConfigFile == "" {
+		return nil
+	}
+
+	if err := web.Validate(Opts.Server.WebConfigFile); err != nil {
+		return fmt.Errorf(`invalid web config file "%v": %w`, Opts.Server.WebConfigFile, err)
+	}
+
+	if Opts.Server.BearerTokenFile != "" {
+		content, err := os.ReadFile(Opts.Server.WebConfigFile)
+		if err != nil {
+			return err
+		}
+
+		webConfig := struct {
+			Users map[string]string `yaml:"basic_auth_users"`
+		}{}
+		if err := yaml.Unmarshal(content, &webConfig); err != nil {
+			return fmt.Errorf(`invalid web config file "%v": %w`, Opts.Server.WebConfigFile, err)
+		}
+
+		if len(webConfig.Users) > 0 {
+			return errors.New(`basic auth users (web config file) and bearer tokens can't be used together`)
+		}
+	}
+
+	return nil
+}
+
+// bearerTokenHandler requires the bearer tokens of the bearer token file for the handler (if configured),
+// only the metrics endpoint is protected so the health probes and the (signed) webhook stay reachable
+func bearerTokenHandler(handler http.Handler) (http.Handler, error) {
+	if Opts.Server.BearerTokenFile == "" {
+		return handler, nil
+	}
+
+	auth := &bearerTokenAuth{path: Opts.Server.BearerTokenFile, handler: handler}
+	if _, err := auth.loadTokens(); err != nil {
+		return nil, err
+	}
+	return auth, nil
+}
+
+func (a *bearerTokenAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tokens, err := a.loadTokens()
+	if err != nil {
+		logger.Error("unable to load bearer tokens", slog.Any("error", err))
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		tokenHash := sha256.Sum256([]byte(strings.TrimSpace(token)))
+
+		valid := 0
+		for _, hash := range tokens {
+			valid |= subtle.ConstantTimeCompare(tokenHash[:], hash[:])
+		}
+
+		if valid == 1 {
+			a.handler.ServeHTTP(w, r)
+			return
+		}
+	}
+
+	w.Header().Set("WWW-Authenticate", "Bearer")
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
+
+// loadTokens returns the (hashed) tokens of the bearer token file, the file is only read if it has been changed
+func (a *bearerTokenAuth) loadTokens() ([][sha256.Size]byte, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	stat, err := os.Stat(a.path)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.tokens != nil && stat.ModTime().Equal(a.modTime) && stat.Size() == a.size {
+		return a.tokens, nil
+	}
+
+	content, err := os.ReadFile(a.path) // #nosec inside container
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := [][sha256.Size]byte{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		if token := strings.TrimSpace(scanner.Text()); token != "" && !strings.HasPrefix(token, "#") {
+			tokens = append(tokens, sha256.Sum256([]byte(token)))
+		}
+	}
+
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf(`bearer token file "%v" doesn't contain any token`, a.path)
+	}
+
+	a.tokens = tokens
+	a.modTime = stat.ModTime()
+	a.size = stat.Size()
+
+	return a.tokens, nil
+}
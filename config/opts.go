@@ -6,71 +6,181 @@ import (
 )
 
 type (
+	PagerDutyAccount struct {
+		Name          string   `json:"name" yaml:"name"`
+		AuthToken     string   `json:"authToken" yaml:"authToken"`
+		AuthTokenFile string   `json:"authTokenFile" yaml:"authTokenFile"`
+		ApiUrl        string   `json:"apiUrl" yaml:"apiUrl"`
+		TeamFilter    []string `json:"teamFilter" yaml:"teamFilter"`
+	}
+
+	MetricFamily struct {
+		Disabled       bool           `json:"disabled" yaml:"disabled"`
+		DropLabels     []string       `json:"dropLabels" yaml:"dropLabels"`
+		TruncateLabels map[string]int `json:"truncateLabels" yaml:"truncateLabels"`
+		MaxSeries      *int           `json:"maxSeries" yaml:"maxSeries"`
+	}
+
 	Opts struct {
+		// config file
+		Config struct {
+			File           string        `long:"config"                  env:"CONFIG"                  description:"Path to YAML config file (flags and env variables take precedence)"`
+			ReloadInterval time.Duration `long:"config.reload-interval"  env:"CONFIG_RELOAD_INTERVAL"  description:"Interval to check config, accounts and token files for changes (time.Duration; 0 = only reload on SIGHUP)" default:"30s"`
+		} `yaml:"-"`
+
 		// logger
 		Logger struct {
-			Level  string `long:"log.level"    env:"LOG_LEVEL"   description:"Log level" choice:"trace" choice:"debug" choice:"info" choice:"warning" choice:"error" default:"info"`                          // nolint:staticcheck // multiple choices are ok
-			Format string `long:"log.format"   env:"LOG_FORMAT"  description:"Log format" choice:"logfmt" choice:"json" default:"logfmt"`                                                                     // nolint:staticcheck // multiple choices are ok
-			Source string `long:"log.source"   env:"LOG_SOURCE"  description:"Show source for every log message (useful for debugging and bug reports)" choice:"" choice:"short" choice:"file" choice:"full"` // nolint:staticcheck // multiple choices are ok
-			Color  string `long:"log.color"    env:"LOG_COLOR"   description:"Enable color for logs" choice:"" choice:"auto" choice:"yes" choice:"no"`                                                        // nolint:staticcheck // multiple choices are ok
-			Time   bool   `long:"log.time"     env:"LOG_TIME"    description:"Show log time"`
-		}
+			Level  string `long:"log.level"    env:"LOG_LEVEL"   description:"Log level" choice:"trace" choice:"debug" choice:"info" choice:"warning" choice:"error" default:"info" yaml:"level"`                           // nolint:staticcheck // multiple choices are ok
+			Format string `long:"log.format"   env:"LOG_FORMAT"  description:"Log format" choice:"logfmt" choice:"json" default:"logfmt" yaml:"format"`                                                                     // nolint:staticcheck // multiple choices are ok
+			Source string `long:"log.source"   env:"LOG_SOURCE"  description:"Show source for every log message (useful for debugging and bug reports)" choice:"" choice:"short" choice:"file" choice:"full" yaml:"source"` // nolint:staticcheck // multiple choices are ok
+			Color  string `long:"log.color"    env:"LOG_COLOR"   description:"Enable color for logs" choice:"" choice:"auto" choice:"yes" choice:"no" yaml:"color"`                                                         // nolint:staticcheck // multiple choices are ok
+			Time   bool   `long:"log.time"     env:"LOG_TIME"    description:"Show log time" yaml:"time"`
+		} `yaml:"logger"`
 
 		// PagerDuty settings
 		PagerDuty struct {
-			AuthToken      string `long:"pagerduty.authtoken"                      env:"PAGERDUTY_AUTH_TOKEN"                         description:"PagerDuty auth token" json:"-"`
-			AuthTokenFile  string `long:"pagerduty.authtokenfile"                  env:"PAGERDUTY_AUTH_TOKEN_FILE"                    description:"PagerDuty auth token as path to file"`
-			MaxConnections int    `long:"pagerduty.max-connections"                env:"PAGERDUTY_MAX_CONNECTIONS"                    description:"Maximum numbers of TCP connections to PagerDuty API (concurrency)" default:"4"`
+			AuthToken      string `long:"pagerduty.authtoken"                      env:"PAGERDUTY_AUTH_TOKEN"                         description:"PagerDuty auth token" json:"-" yaml:"authToken"`
+			AuthTokenFile  string `long:"pagerduty.authtokenfile"                  env:"PAGERDUTY_AUTH_TOKEN_FILE"                    description:"PagerDuty auth token as path to file" yaml:"authTokenFile"`
+			MaxConnections int    `long:"pagerduty.max-connections"                env:"PAGERDUTY_MAX_CONNECTIONS"                    description:"Maximum numbers of TCP connections to PagerDuty API per account (concurrency)" default:"4" yaml:"maxConnections"`
+			ApiUrl         string `long:"pagerduty.api-url"                        env:"PAGERDUTY_API_URL"                            description:"PagerDuty API url (eg. for EU service region)" yaml:"apiUrl"`
+			AccountsFile   string `long:"pagerduty.accounts-file"                  env:"PAGERDUTY_ACCOUNTS_FILE"                      description:"Path to YAML/JSON file with list of PagerDuty accounts (name, authToken, authTokenFile, apiUrl, teamFilter), replaces the auth token options" yaml:"accountsFile"`
+
+			Accounts []PagerDutyAccount `no-flag:"true" yaml:"accounts"`
+
+			RateLimit struct {
+				RequestsPerMinute int           `long:"pagerduty.ratelimit.requests-per-minute"  env:"PAGERDUTY_RATELIMIT_REQUESTS_PER_MINUTE"      description:"Maximum number of PagerDuty API requests per minute shared by all collectors of an account (0 = unlimited)" default:"0" yaml:"requestsPerMinute"`
+				Retries           int           `long:"pagerduty.ratelimit.retries"              env:"PAGERDUTY_RATELIMIT_RETRIES"                  description:"Number of retries for rate limited or failed PagerDuty API GET requests" default:"3" yaml:"retries"`
+				Backoff           time.Duration `long:"pagerduty.ratelimit.backoff"              env:"PAGERDUTY_RATELIMIT_BACKOFF"                  description:"Initial backoff for retries of PagerDuty API requests (time.Duration; exponential with jitter)" default:"1s" yaml:"backoff"`
+				MaxBackoff        time.Duration `long:"pagerduty.ratelimit.max-backoff"          env:"PAGERDUTY_RATELIMIT_MAX_BACKOFF"              description:"Maximum backoff or rate limit wait time for retries of PagerDuty API requests (time.Duration)" default:"60s" yaml:"maxBackoff"`
+			} `yaml:"rateLimit"`
 
 			Schedule struct {
-				OverrideTimeframe time.Duration `long:"pagerduty.schedule.override-duration"     env:"PAGERDUTY_SCHEDULE_OVERRIDE_TIMEFRAME"        description:"PagerDuty timeframe for fetching schedule overrides (time.Duration)" default:"48h"`
-				EntryTimeframe    time.Duration `long:"pagerduty.schedule.entry-timeframe"       env:"PAGERDUTY_SCHEDULE_ENTRY_TIMEFRAME"           description:"PagerDuty timeframe for fetching schedule entries (time.Duration)" default:"72h"`
-				EntryTimeFormat   string        `long:"pagerduty.schedule.entry-timeformat"      env:"PAGERDUTY_SCHEDULE_ENTRY_TIMEFORMAT"          description:"PagerDuty schedule entry time format (label)" default:"Mon, 02 Jan 15:04 MST"`
-			}
+				OverrideTimeframe time.Duration `long:"pagerduty.schedule.override-duration"     env:"PAGERDUTY_SCHEDULE_OVERRIDE_TIMEFRAME"        description:"PagerDuty timeframe for fetching schedule overrides (time.Duration)" default:"48h" yaml:"overrideTimeframe"`
+				EntryTimeframe    time.Duration `long:"pagerduty.schedule.entry-timeframe"       env:"PAGERDUTY_SCHEDULE_ENTRY_TIMEFRAME"           description:"PagerDuty timeframe for fetching schedule entries (time.Duration)" default:"72h" yaml:"entryTimeframe"`
+				EntryTimeFormat   string        `long:"pagerduty.schedule.entry-timeformat"      env:"PAGERDUTY_SCHEDULE_ENTRY_TIMEFORMAT"          description:"PagerDuty schedule entry time format (label)" default:"Mon, 02 Jan 15:04 MST" yaml:"entryTimeFormat"`
+				OnCallLookBack    time.Duration `long:"pagerduty.schedule.oncall-lookback"       env:"PAGERDUTY_SCHEDULE_ONCALL_LOOKBACK"           description:"PagerDuty timeframe for oncall time accounting in the past (time.Duration; 0 = disabled)" default:"0" yaml:"onCallLookBack"`
+				OnCallLookAhead   time.Duration `long:"pagerduty.schedule.oncall-lookahead"      env:"PAGERDUTY_SCHEDULE_ONCALL_LOOKAHEAD"          description:"PagerDuty timeframe for oncall time accounting in the future (time.Duration; 0 = disabled)" default:"0" yaml:"onCallLookAhead"`
+				GapLookAhead      time.Duration `long:"pagerduty.schedule.gap-lookahead"         env:"PAGERDUTY_SCHEDULE_GAP_LOOKAHEAD"             description:"PagerDuty timeframe for detecting schedule gaps, the start of the current gap is searched within the same timeframe in the past (time.Duration; 0 = entry timeframe)" default:"0" yaml:"gapLookAhead"`
+				Holidays          []string      `long:"pagerduty.schedule.holidays"              env:"PAGERDUTY_SCHEDULE_HOLIDAYS" env-delim:","    description:"Holidays (YYYY-MM-DD) for oncall time accounting" yaml:"holidays"`
+				BusinessHours     string        `long:"pagerduty.schedule.business-hours"        env:"PAGERDUTY_SCHEDULE_BUSINESS_HOURS"            description:"Business hours (HH:MM-HH:MM, time zone of the schedule) for oncall time accounting" default:"09:00-17:00" yaml:"businessHours"`
+				WeekendDays       []string      `long:"pagerduty.schedule.weekend-days"          env:"PAGERDUTY_SCHEDULE_WEEKEND_DAYS" env-delim:"," description:"Weekend days for oncall time accounting" default:"saturday" default:"sunday" choice:"monday" choice:"tuesday" choice:"wednesday" choice:"thursday" choice:"friday" choice:"saturday" choice:"sunday" yaml:"weekendDays"` // nolint:staticcheck // multiple choices are ok
+			} `yaml:"schedule"`
 
 			Incident struct {
-				Statuses   []string `long:"pagerduty.incident.status"                env:"PAGERDUTY_INCIDENT_STATUS" env-delim:";"      description:"PagerDuty incident status filter (eg. 'triggered', 'acknowledged', 'resolved' or 'all')" default:"triggered" default:"acknowledged" choice:"triggered"  choice:"acknowledged"  choice:"resolved"  choice:"all"` // nolint:staticcheck
-				TimeFormat string   `long:"pagerduty.incident.timeformat"            env:"PAGERDUTY_INCIDENT_TIMEFORMAT"                description:"PagerDuty incident time format (label)" default:"Mon, 02 Jan 15:04 MST"`
-				Limit      uint     `long:"pagerduty.incident.limit"                 env:"PAGERDUTY_INCIDENT_LIMIT"                     description:"PagerDuty incident limit count"         default:"5000"`
-			}
+				Statuses   []string `long:"pagerduty.incident.status"                env:"PAGERDUTY_INCIDENT_STATUS" env-delim:";"      description:"PagerDuty incident status filter (eg. 'triggered', 'acknowledged', 'resolved' or 'all')" default:"triggered" default:"acknowledged" choice:"triggered"  choice:"acknowledged"  choice:"resolved"  choice:"all" yaml:"statuses"` // nolint:staticcheck
+				TimeFormat string   `long:"pagerduty.incident.timeformat"            env:"PAGERDUTY_INCIDENT_TIMEFORMAT"                description:"PagerDuty incident time format (label)" default:"Mon, 02 Jan 15:04 MST" yaml:"timeFormat"`
+				Limit      uint     `long:"pagerduty.incident.limit"                 env:"PAGERDUTY_INCIDENT_LIMIT"                     description:"PagerDuty incident limit count"         default:"5000" yaml:"limit"`
+
+				AlertInfo      bool `long:"pagerduty.incident.alert-info"          env:"PAGERDUTY_INCIDENT_ALERT_INFO"           description:"Export alert information (severity, source component and dedup key) of open incidents (one API request per open incident)" yaml:"alertInfo"`
+				AlertInfoLimit uint `long:"pagerduty.incident.alert-info.limit"    env:"PAGERDUTY_INCIDENT_ALERT_INFO_LIMIT"     description:"PagerDuty alert limit count per incident for alert information" default:"25" yaml:"alertInfoLimit"`
+
+				EscalationLevel      bool `long:"pagerduty.incident.escalation-level"        env:"PAGERDUTY_INCIDENT_ESCALATION_LEVEL"         description:"Export the escalation level of open incidents (log entry requests per open incident, only if the incident changed)" yaml:"escalationLevel"`
+				EscalationLevelLimit uint `long:"pagerduty.incident.escalation-level.limit"  env:"PAGERDUTY_INCIDENT_ESCALATION_LEVEL_LIMIT"   description:"PagerDuty incident limit count for escalation level updates per run" default:"50" yaml:"escalationLevelLimit"`
+			} `yaml:"incident"`
 
 			Teams struct {
-				Disable bool     `long:"pagerduty.disable-teams"                  env:"PAGERDUTY_DISABLE_TEAMS"                      description:"Set to true to disable checking PagerDuty teams (for plans that don't include it)"                `
-				Filter  []string `long:"pagerduty.team-filter" env-delim:","      env:"PAGERDUTY_TEAM_FILTER"                        description:"Passes team ID as a list option when applicable."`
-			}
+				Disable bool     `long:"pagerduty.disable-teams"                  env:"PAGERDUTY_DISABLE_TEAMS"                      description:"Set to true to disable checking PagerDuty teams (for plans that don't include it)"                 yaml:"disable"`
+				Filter  []string `long:"pagerduty.team-filter" env-delim:","      env:"PAGERDUTY_TEAM_FILTER"                        description:"Passes team ID as a list option when applicable." yaml:"filter"`
+			} `yaml:"teams"`
+
+			Analytics struct {
+				Since         time.Duration `long:"pagerduty.analytics.since"           env:"PAGERDUTY_ANALYTICS_SINCE"            description:"Timeframe which data should be fetched for analytics metrics (time.Duration)" default:"730h" yaml:"since"`
+				AggregateUnit string        `long:"pagerduty.analytics.aggregate-unit"  env:"PAGERDUTY_ANALYTICS_AGGREGATE_UNIT"   description:"Aggregation unit for analytics metrics (empty for whole timeframe)" choice:"" choice:"day" choice:"week" choice:"month" yaml:"aggregateUnit"` // nolint:staticcheck // multiple choices are ok
+				TimeZone      string        `long:"pagerduty.analytics.timezone"        env:"PAGERDUTY_ANALYTICS_TIMEZONE"         description:"Time zone used for aggregation of analytics metrics" default:"Etc/UTC" yaml:"timeZone"`
+			} `yaml:"analytics"`
+
+			Timeline struct {
+				Since time.Duration `long:"pagerduty.timeline.since"  env:"PAGERDUTY_TIMELINE_SINCE"  description:"Timeframe which incidents should be fetched for timeline metrics (time.Duration)" default:"24h" yaml:"since"`
+				Limit uint          `long:"pagerduty.timeline.limit"  env:"PAGERDUTY_TIMELINE_LIMIT"  description:"PagerDuty incident limit count for timeline metrics (one API request per incident)" default:"500" yaml:"limit"`
+			} `yaml:"timeline"`
+
+			BusinessServiceImpact struct {
+				IncidentInterval time.Duration `long:"pagerduty.businessservice-impact.incident-interval"  env:"PAGERDUTY_BUSINESSSERVICE_IMPACT_INCIDENT_INTERVAL"  description:"Interval for counting the open incidents impacting the business services (time.Duration; one API request per open incident)" default:"15m" yaml:"incidentInterval"`
+				IncidentLimit    uint          `long:"pagerduty.businessservice-impact.incident-limit"     env:"PAGERDUTY_BUSINESSSERVICE_IMPACT_INCIDENT_LIMIT"     description:"Maximum number of open incidents checked for business service impacts (0 = disabled)" default:"100" yaml:"incidentLimit"`
+			} `yaml:"businessServiceImpact"`
+
+			Notification struct {
+				BusinessHours   string   `long:"pagerduty.notification.business-hours"    env:"PAGERDUTY_NOTIFICATION_BUSINESS_HOURS"    description:"Business hours (HH:MM-HH:MM, time zone of the user) for the notification period" default:"09:00-17:00" yaml:"businessHours"`
+				SleepHours      string   `long:"pagerduty.notification.sleep-hours"       env:"PAGERDUTY_NOTIFICATION_SLEEP_HOURS"       description:"Sleep hours (HH:MM-HH:MM, time zone of the user) for the notification period" default:"22:00-07:00" yaml:"sleepHours"`
+				WeekendDays     []string `long:"pagerduty.notification.weekend-days"      env:"PAGERDUTY_NOTIFICATION_WEEKEND_DAYS"      env-delim:"," description:"Weekend days for the notification period" default:"saturday" default:"sunday" choice:"monday" choice:"tuesday" choice:"wednesday" choice:"thursday" choice:"friday" choice:"saturday" choice:"sunday" yaml:"weekendDays"` // nolint:staticcheck // multiple choices are ok
+				DefaultTimeZone string   `long:"pagerduty.notification.default-timezone"  env:"PAGERDUTY_NOTIFICATION_DEFAULT_TIMEZONE"  description:"Time zone for the notification period of users without known time zone" default:"Etc/UTC" yaml:"defaultTimeZone"`
+			} `yaml:"notification"`
+
+			Pii struct {
+				UserName     string `long:"pagerduty.pii.user-name"      env:"PAGERDUTY_PII_USER_NAME"       description:"Policy for user name labels" choice:"keep" choice:"drop" choice:"hash" default:"keep" yaml:"userName"`                  // nolint:staticcheck // multiple choices are ok
+				UserMail     string `long:"pagerduty.pii.user-mail"      env:"PAGERDUTY_PII_USER_MAIL"       description:"Policy for user email labels" choice:"keep" choice:"drop" choice:"hash" choice:"domain" default:"keep" yaml:"userMail"` // nolint:staticcheck // multiple choices are ok
+				UserAvatar   string `long:"pagerduty.pii.user-avatar"    env:"PAGERDUTY_PII_USER_AVATAR"     description:"Policy for user avatar labels" choice:"keep" choice:"drop" choice:"hash" default:"keep" yaml:"userAvatar"`              // nolint:staticcheck // multiple choices are ok
+				UserJobTitle string `long:"pagerduty.pii.user-jobtitle"  env:"PAGERDUTY_PII_USER_JOBTITLE"   description:"Policy for user job title labels" choice:"keep" choice:"drop" choice:"hash" default:"keep" yaml:"userJobTitle"`         // nolint:staticcheck // multiple choices are ok
+				HashKey      string `long:"pagerduty.pii.hash-key"       env:"PAGERDUTY_PII_HASH_KEY"        description:"Secret key for the pseudonyms (HMAC-SHA256) of the hash policy" json:"-" yaml:"hashKey"`
+				HashKeyFile  string `long:"pagerduty.pii.hash-key-file"  env:"PAGERDUTY_PII_HASH_KEY_FILE"   description:"Secret key for the pseudonyms (HMAC-SHA256) of the hash policy as path to file" yaml:"hashKeyFile"`
+			} `yaml:"pii"`
+
+			Webhook struct {
+				Secrets []string `long:"pagerduty.webhook.secret"  env:"PAGERDUTY_WEBHOOK_SECRET" env-delim:","  description:"PagerDuty v3 webhook signing secret, enables webhook receiver (multiple secrets possible for rotation)" json:"-" yaml:"secrets"`
+				Path    string   `long:"pagerduty.webhook.path"    env:"PAGERDUTY_WEBHOOK_PATH"                  description:"Path of PagerDuty v3 webhook receiver" default:"/webhook/pagerduty" yaml:"path"`
+			} `yaml:"webhook"`
 
 			Summary struct {
-				Since time.Duration `long:"pagerduty.summary.since"     env:"PAGERDUTY_SUMMARY_SINCE"        description:"Timeframe which data should be fetched for summary metrics (time.Duration)" default:"730h"`
-			}
-		}
+				Since time.Duration `long:"pagerduty.summary.since"     env:"PAGERDUTY_SUMMARY_SINCE"        description:"Timeframe which data should be fetched for summary metrics (time.Duration)" default:"730h" yaml:"since"`
+			} `yaml:"summary"`
+		} `yaml:"pagerDuty"`
 
 		// general options
 		Server struct {
 			// general options
-			Bind         string        `long:"server.bind"              env:"SERVER_BIND"           description:"Server address"        default:":8080"`
-			ReadTimeout  time.Duration `long:"server.timeout.read"      env:"SERVER_TIMEOUT_READ"   description:"Server read timeout"   default:"5s"`
-			WriteTimeout time.Duration `long:"server.timeout.write"     env:"SERVER_TIMEOUT_WRITE"  description:"Server write timeout"  default:"10s"`
-		}
+			Bind         string        `long:"server.bind"              env:"SERVER_BIND"           description:"Server address"        default:":8080" yaml:"bind"`
+			ReadTimeout  time.Duration `long:"server.timeout.read"      env:"SERVER_TIMEOUT_READ"   description:"Server read timeout"   default:"5s" yaml:"readTimeout"`
+			WriteTimeout time.Duration `long:"server.timeout.write"     env:"SERVER_TIMEOUT_WRITE"  description:"Server write timeout"  default:"10s" yaml:"writeTimeout"`
+
+			// web config (TLS and auth)
+			WebConfigFile   string `long:"server.web.config-file"       env:"SERVER_WEB_CONFIG_FILE"       description:"Path to web config file (exporter-toolkit format) for TLS, client certificate validation and basic auth" yaml:"webConfigFile"`
+			BearerTokenFile string `long:"server.web.bearer-token-file" env:"SERVER_WEB_BEARER_TOKEN_FILE" description:"Path to file with bearer tokens (one per line) required for /metrics" yaml:"bearerTokenFile"`
+
+			// health check options
+			LivenessStuckFactor float64 `long:"server.liveness.stuck-factor" env:"SERVER_LIVENESS_STUCK_FACTOR" description:"Liveness check fails if a collector run takes longer than this factor of its scrape time (without rate limit waits, 0 = disabled)" default:"5" yaml:"livenessStuckFactor"`
+		} `yaml:"server"`
 
 		// caching
 		Cache struct {
-			Path string `long:"cache.path" env:"CACHE_PATH" description:"Cache path (to folder, file://path... or azblob://storageaccount.blob.core.windows.net/containername or k8scm://{namespace}/{configmap}})"`
-		}
+			Path string `long:"cache.path" env:"CACHE_PATH" description:"Cache path (to folder, file://path... or azblob://storageaccount.blob.core.windows.net/containername or k8scm://{namespace}/{configmap}})" yaml:"path"`
+		} `yaml:"cache"`
+
+		// metric guardrails
+		Metrics struct {
+			MaxSeries int `long:"metrics.max-series"  env:"METRICS_MAX_SERIES"  description:"Maximum number of series per metric family and account, additional series are dropped (0 = unlimited)" default:"0" yaml:"maxSeries"`
+
+			Families map[string]MetricFamily `no-flag:"true" yaml:"families"`
+		} `yaml:"metrics"`
 
 		ScrapeTime struct {
-			General           time.Duration  `long:"scrape.time"          env:"SCRAPE_TIME"            description:"Scrape time (time.duration)"                              default:"5m"`
-			MaintenanceWindow *time.Duration `long:"scrape.time.maintenancewindow"  env:"SCRAPE_TIME_MAINTENANCEWINDOW"    description:"Scrape time for maintenance window metrics (time.duration; default is SCRAPE_TIME)"`
-			Schedule          *time.Duration `long:"scrape.time.schedule"  env:"SCRAPE_TIME_SCHEDULE"    description:"Scrape time for schedule metrics (time.duration; default is SCRAPE_TIME)"`
-			Service           *time.Duration `long:"scrape.time.service"  env:"SCRAPE_TIME_SERVICE"    description:"Scrape time for service metrics (time.duration; default is SCRAPE_TIME)"`
-			Team              *time.Duration `long:"scrape.time.team"  env:"SCRAPE_TIME_TEAM"    description:"Scrape time for team metrics (time.duration; default is SCRAPE_TIME)"`
-			User              *time.Duration `long:"scrape.time.user"  env:"SCRAPE_TIME_USER"    description:"Scrape time for user metrics (time.duration; default is SCRAPE_TIME)"`
-			Summary           time.Duration  `long:"scrape.time.summary"  env:"SCRAPE_TIME_SUMMARY"    description:"Scrape time for general summary metrics (time.duration)"  default:"15m"`
-			System            time.Duration  `long:"scrape.time.system"  env:"SCRAPE_TIME_SYSTEM"    description:"Scrape time for general system (time.duration)"  default:"15m"`
-			Live              time.Duration  `long:"scrape.time.live"     env:"SCRAPE_TIME_LIVE"       description:"Scrape time incidents and oncalls (time.duration)"        default:"1m"`
-		}
+			General           time.Duration  `long:"scrape.time"          env:"SCRAPE_TIME"            description:"Scrape time (time.duration)"                              default:"5m" yaml:"general"`
+			EscalationPolicy  *time.Duration `long:"scrape.time.escalationpolicy"  env:"SCRAPE_TIME_ESCALATIONPOLICY"    description:"Scrape time for escalation policy metrics (time.duration; default is SCRAPE_TIME)" yaml:"escalationPolicy"`
+			MaintenanceWindow *time.Duration `long:"scrape.time.maintenancewindow"  env:"SCRAPE_TIME_MAINTENANCEWINDOW"    description:"Scrape time for maintenance window metrics (time.duration; default is SCRAPE_TIME)" yaml:"maintenanceWindow"`
+			Schedule          *time.Duration `long:"scrape.time.schedule"  env:"SCRAPE_TIME_SCHEDULE"    description:"Scrape time for schedule metrics (time.duration; default is SCRAPE_TIME)" yaml:"schedule"`
+			Service           *time.Duration `long:"scrape.time.service"  env:"SCRAPE_TIME_SERVICE"    description:"Scrape time for service metrics (time.duration; default is SCRAPE_TIME)" yaml:"service"`
+			BusinessService   *time.Duration `long:"scrape.time.businessservice"  env:"SCRAPE_TIME_BUSINESSSERVICE"    description:"Scrape time for business service and service dependency metrics (time.duration; default is SCRAPE_TIME)" yaml:"businessService"`
+			Team              *time.Duration `long:"scrape.time.team"  env:"SCRAPE_TIME_TEAM"    description:"Scrape time for team metrics (time.duration; default is SCRAPE_TIME)" yaml:"team"`
+			User              *time.Duration `long:"scrape.time.user"  env:"SCRAPE_TIME_USER"    description:"Scrape time for user metrics (time.duration; default is SCRAPE_TIME)" yaml:"user"`
+			Analytics         time.Duration  `long:"scrape.time.analytics"  env:"SCRAPE_TIME_ANALYTICS"    description:"Scrape time for incident analytics metrics (time.duration; 0 = disabled)"  default:"0" yaml:"analytics"`
+			Timeline          time.Duration  `long:"scrape.time.timeline"  env:"SCRAPE_TIME_TIMELINE"    description:"Scrape time for incident timeline metrics (time.duration; 0 = disabled)"  default:"0" yaml:"timeline"`
+			LogStream         time.Duration  `long:"scrape.time.logstream"  env:"SCRAPE_TIME_LOGSTREAM"    description:"Scrape time for log entry stream metrics (time.duration; 0 = disabled)"  default:"0" yaml:"logStream"`
+			Summary           time.Duration  `long:"scrape.time.summary"  env:"SCRAPE_TIME_SUMMARY"    description:"Scrape time for general summary metrics (time.duration)"  default:"15m" yaml:"summary"`
+			System            time.Duration  `long:"scrape.time.system"  env:"SCRAPE_TIME_SYSTEM"    description:"Scrape time for general system (time.duration)"  default:"15m" yaml:"system"`
+			Live              time.Duration  `long:"scrape.time.live"     env:"SCRAPE_TIME_LIVE"       description:"Scrape time incidents and oncalls (time.duration)"        default:"1m" yaml:"live"`
+		} `yaml:"scrapeTime"`
 	}
 )
 
+// MarshalJSON hides the auth token (eg. for logging)
+func (a PagerDutyAccount) MarshalJSON() ([]byte, error) {
+	type account PagerDutyAccount
+	ret := account(a)
+	if ret.AuthToken != "" {
+		ret.AuthToken = "***"
+	}
+	return json.Marshal(ret)
+}
+
 func (o *Opts) GetCachePath(path string) (ret *string) {
 	if o.Cache.Path != "" {
 		tmp := o.Cache.Path + "/" + path
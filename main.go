@@ -9,10 +9,8 @@ import (
 	"net/url"
 	"os"
 	"runtime"
-	"strings"
 	"time"
 
-	"github.com/PagerDuty/go-pagerduty"
 	"github.com/jessevdk/go-flags"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -26,14 +24,27 @@ const (
 
 	// PagerdutyListLimit limits the amount of items returned from an API query
 	PagerdutyListLimit = 100
+
+	// failed collector runs are passed as panic to the collector (backoff, no cache), the panics must
+	// never be passed through as this would stop the exporter (eg. on PagerDuty outages or revoked tokens)
+	collectorPanicThreshold = -1
 )
 
 var (
 	argparser *flags.Parser
 	Opts      config.Opts
 
-	PagerDutyClient               *pagerduty.Client
-	PrometheusPagerDutyApiCounter *prometheus.CounterVec
+	PagerDutyAccounts                 []*PagerDutyAccount
+	PrometheusPagerDutyApiCounter     *prometheus.CounterVec
+	PrometheusPagerDutyApiRequests    *prometheus.CounterVec
+	PrometheusPagerDutyApiDuration    *prometheus.HistogramVec
+	PrometheusPagerDutyApiRateLimited *prometheus.CounterVec
+	PrometheusPagerDutyApiRetries     *prometheus.CounterVec
+
+	PrometheusCollectorErrors      *prometheus.CounterVec
+	PrometheusCollectorLastSuccess *prometheus.GaugeVec
+
+	PagerDutyWebhook *WebhookReceiver
 
 	// Git version information
 	gitCommit = "<unknown>"
@@ -55,6 +66,8 @@ func main() {
 	logger.Info("starting metrics collection")
 	initMetricCollector()
 
+	startConfigReloader()
+
 	logger.Info("starting http server", slog.String("bind", Opts.Server.Bind))
 	startHTTPServer()
 }
@@ -75,220 +88,414 @@ func initArgparser() {
 		}
 	}
 
-	// Load the AuthTokenFile into the AuthToken with some validation
-	if Opts.PagerDuty.AuthTokenFile != "" {
-		data, err := os.ReadFile(Opts.PagerDuty.AuthTokenFile)
-		if err != nil {
-			logger.Fatalf("failed to read token from file: %v", err.Error())
-		}
-		Opts.PagerDuty.AuthToken = strings.TrimSpace(string(data))
-	}
-
-	if Opts.PagerDuty.AuthToken == "" {
-		fmt.Println("ERROR: An authtoken or an authtokenfile must be specified")
+	if err := loadConfig(argparser, &Opts); err != nil {
+		fmt.Printf("ERROR: %v\n", err)
 		argparser.WriteHelp(os.Stdout)
 		os.Exit(1)
 	}
+}
 
-	if len(Opts.PagerDuty.Incident.Statuses) == 1 {
-		if strings.ToLower(Opts.PagerDuty.Incident.Statuses[0]) == "all" {
-			Opts.PagerDuty.Incident.Statuses = []string{
-				"triggered",
-				"acknowledged",
-				"resolved",
-			}
-		}
-	}
+// Init and build PagerDuty clients
+func initPagerDuty() {
+	PrometheusPagerDutyApiCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "pagerduty_api_counter",
+			Help: "Pagerduty api counter",
+		},
+		[]string{
+			"account",
+			"name",
+		},
+	)
+	prometheus.MustRegister(PrometheusPagerDutyApiCounter)
 
-	if Opts.ScrapeTime.MaintenanceWindow == nil {
-		Opts.ScrapeTime.MaintenanceWindow = &Opts.ScrapeTime.General
-	}
+	PrometheusPagerDutyApiRequests = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "pagerduty_api_requests_total",
+			Help: "Pagerduty api requests",
+		},
+		[]string{
+			"account",
+			"endpoint",
+			"method",
+			"statusClass",
+		},
+	)
+	prometheus.MustRegister(PrometheusPagerDutyApiRequests)
 
-	if Opts.ScrapeTime.Schedule == nil {
-		Opts.ScrapeTime.Schedule = &Opts.ScrapeTime.General
-	}
+	PrometheusPagerDutyApiDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "pagerduty_api_request_duration_seconds",
+			Help:    "Pagerduty api request duration",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{
+			"account",
+			"endpoint",
+			"method",
+			"statusClass",
+		},
+	)
+	prometheus.MustRegister(PrometheusPagerDutyApiDuration)
 
-	if Opts.ScrapeTime.Service == nil {
-		Opts.ScrapeTime.Service = &Opts.ScrapeTime.General
-	}
-	if Opts.ScrapeTime.Team == nil {
-		Opts.ScrapeTime.Team = &Opts.ScrapeTime.General
-	}
+	PrometheusPagerDutyApiRateLimited = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "pagerduty_api_ratelimited_total",
+			Help: "Pagerduty api requests which were rate limited (HTTP 429)",
+		},
+		[]string{
+			"account",
+		},
+	)
+	prometheus.MustRegister(PrometheusPagerDutyApiRateLimited)
 
-	if Opts.ScrapeTime.User == nil {
-		Opts.ScrapeTime.User = &Opts.ScrapeTime.General
+	PrometheusPagerDutyApiRetries = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "pagerduty_api_retries_total",
+			Help: "Pagerduty api request retries",
+		},
+		[]string{
+			"account",
+		},
+	)
+	prometheus.MustRegister(PrometheusPagerDutyApiRetries)
+
+	for _, accountConfig := range Opts.PagerDuty.Accounts {
+		account := newPagerDutyAccount(accountConfig)
+		PagerDutyAccounts = append(PagerDutyAccounts, account)
+
+		prometheus.MustRegister(prometheus.NewGaugeFunc(
+			prometheus.GaugeOpts{
+				Name:        "pagerduty_api_ratelimit_budget",
+				Help:        "Pagerduty api currently available request budget (-1 = unlimited)",
+				ConstLabels: account.constLabels(),
+			},
+			account.transport.Budget,
+		))
 	}
 }
 
-// Init and build PagerDuty client
-func initPagerDuty() {
-	PagerDutyClient = pagerduty.NewClient(Opts.PagerDuty.AuthToken)
+// newPagerDutyAccount builds the PagerDuty client for the account, every account has its own
+// connections and request budget
+func newPagerDutyAccount(accountConfig config.PagerDutyAccount) *PagerDutyAccount {
+	account := &PagerDutyAccount{Name: accountConfig.Name}
 
 	httpClientTransportProxy := http.ProxyFromEnvironment
 	if Opts.Logger.Level == "trace" {
 		httpClientTransportProxy = pagerdutyRequestLogger
 	}
 
-	PagerDutyClient.HTTPClient = &http.Client{
-		Transport: &http.Transport{
-			Proxy: httpClientTransportProxy,
-			DialContext: (&net.Dialer{
-				Timeout:   30 * time.Second,
-				KeepAlive: 30 * time.Second,
-			}).DialContext,
-			MaxConnsPerHost:       Opts.PagerDuty.MaxConnections,
-			MaxIdleConns:          Opts.PagerDuty.MaxConnections,
-			IdleConnTimeout:       60 * time.Second,
-			TLSHandshakeTimeout:   10 * time.Second,
-			ExpectContinueTimeout: 1 * time.Second,
-			MaxIdleConnsPerHost:   runtime.GOMAXPROCS(0) + 1,
-		},
+	httpTransport := &http.Transport{
+		Proxy: httpClientTransportProxy,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxConnsPerHost:       Opts.PagerDuty.MaxConnections,
+		MaxIdleConns:          Opts.PagerDuty.MaxConnections,
+		IdleConnTimeout:       60 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		MaxIdleConnsPerHost:   runtime.GOMAXPROCS(0) + 1,
 	}
 
-	PrometheusPagerDutyApiCounter = prometheus.NewCounterVec(
+	// retries and rate limiting wrap the instrumentation, so every single request attempt is recorded
+	account.transport = newPagerdutyTransport(account.Name, &pagerdutyInstrumentedTransport{account: account.Name, transport: httpTransport})
+
+	account.applyConfig(accountConfig)
+
+	return account
+}
+
+func initMetricCollector() {
+	PrometheusCollectorErrors = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
-			Name: "pagerduty_api_counter",
-			Help: "Pagerduty api counter",
+			Name: "pagerduty_collector_errors_total",
+			Help: "Pagerduty collector errors by endpoint and error class",
 		},
 		[]string{
-			"name",
+			"account",
+			"collector",
+			"endpoint",
+			"class",
 		},
 	)
-	prometheus.MustRegister(PrometheusPagerDutyApiCounter)
+	prometheus.MustRegister(PrometheusCollectorErrors)
+
+	PrometheusCollectorLastSuccess = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "pagerduty_collector_last_success_timestamp_seconds",
+			Help: "Pagerduty collector timestamp of last run without errors",
+		},
+		[]string{
+			"account",
+			"collector",
+		},
+	)
+	prometheus.MustRegister(PrometheusCollectorLastSuccess)
+
+	initMetricGuardrails()
+
+	if len(Opts.PagerDuty.Webhook.Secrets) > 0 {
+		PagerDutyWebhook = NewWebhookReceiver()
+	}
+
+	for _, account := range PagerDutyAccounts {
+		initAccountMetricCollector(account)
+	}
+
+	warnUnknownMetricFamilies()
 }
 
-func initMetricCollector() {
+// initAccountMetricCollector starts all enabled collectors for the PagerDuty account
+func initAccountMetricCollector(account *PagerDutyAccount) {
 	var collectorName string
 
-	cacheTag := collector.BuildCacheTag(gitTag, Opts.PagerDuty)
+	cacheTag := collector.BuildCacheTag(gitTag, Opts.PagerDuty, Opts.Metrics, account.Name)
 
 	if !Opts.PagerDuty.Teams.Disable {
 		collectorName = "Team"
 		if Opts.ScrapeTime.Team.Seconds() > 0 {
-			c := collector.New(collectorName, &MetricsCollectorTeam{}, logger.Slog())
+			c := collector.New(account.collectorName(collectorName), &MetricsCollectorTeam{PagerDutyProcessor: newPagerDutyProcessor(account, collectorName, func(opts *config.Opts) time.Duration { return *opts.ScrapeTime.Team })}, account.logger())
 			c.SetScapeTime(*Opts.ScrapeTime.Team)
-			if err := c.SetCache(Opts.GetCachePath("team.json"), cacheTag); err != nil {
+			c.SetPanicThreshold(collectorPanicThreshold)
+			if err := c.SetCache(account.cachePath("team.json"), cacheTag); err != nil {
 				panic(err)
 			}
 			if err := c.Start(); err != nil {
 				logger.Panic(err.Error())
 			}
 		} else {
-			logger.With(slog.String("collector", collectorName)).Infof("collector disabled")
+			logger.With(slog.String("account", account.Name), slog.String("collector", collectorName)).Infof("collector disabled")
 		}
 	}
 
 	collectorName = "User"
 	if Opts.ScrapeTime.User.Seconds() > 0 {
-		c := collector.New(collectorName, &MetricsCollectorUser{teamListOpt: Opts.PagerDuty.Teams.Filter}, logger.Slog())
+		c := collector.New(account.collectorName(collectorName), &MetricsCollectorUser{PagerDutyProcessor: newPagerDutyProcessor(account, collectorName, func(opts *config.Opts) time.Duration { return *opts.ScrapeTime.User })}, account.logger())
 		c.SetScapeTime(*Opts.ScrapeTime.User)
-		if err := c.SetCache(Opts.GetCachePath("user.json"), cacheTag); err != nil {
+		c.SetPanicThreshold(collectorPanicThreshold)
+		if err := c.SetCache(account.cachePath("user.json"), cacheTag); err != nil {
 			panic(err)
 		}
 		if err := c.Start(); err != nil {
 			logger.Panic(err.Error())
 		}
 	} else {
-		logger.With(slog.String("collector", collectorName)).Infof("collector disabled")
+		logger.With(slog.String("account", account.Name), slog.String("collector", collectorName)).Infof("collector disabled")
 	}
 
 	collectorName = "Service"
 	if Opts.ScrapeTime.Service.Seconds() > 0 {
-		c := collector.New(collectorName, &MetricsCollectorService{teamListOpt: Opts.PagerDuty.Teams.Filter}, logger.Slog())
+		c := collector.New(account.collectorName(collectorName), &MetricsCollectorService{PagerDutyProcessor: newPagerDutyProcessor(account, collectorName, func(opts *config.Opts) time.Duration { return *opts.ScrapeTime.Service })}, account.logger())
 		c.SetScapeTime(*Opts.ScrapeTime.Service)
-		if err := c.SetCache(Opts.GetCachePath("service.json"), cacheTag); err != nil {
+		c.SetPanicThreshold(collectorPanicThreshold)
+		if err := c.SetCache(account.cachePath("service.json"), cacheTag); err != nil {
 			panic(err)
 		}
 		if err := c.Start(); err != nil {
 			logger.Panic(err.Error())
 		}
 	} else {
-		logger.With(slog.String("collector", collectorName)).Infof("collector disabled")
+		logger.With(slog.String("account", account.Name), slog.String("collector", collectorName)).Infof("collector disabled")
+
+	}
 
+	collectorName = "BusinessService"
+	if Opts.ScrapeTime.BusinessService.Seconds() > 0 {
+		c := collector.New(account.collectorName(collectorName), &MetricsCollectorBusinessService{PagerDutyProcessor: newPagerDutyProcessor(account, collectorName, func(opts *config.Opts) time.Duration { return *opts.ScrapeTime.BusinessService })}, account.logger())
+		c.SetScapeTime(*Opts.ScrapeTime.BusinessService)
+		c.SetPanicThreshold(collectorPanicThreshold)
+		if err := c.SetCache(account.cachePath("businessservice.json"), cacheTag); err != nil {
+			panic(err)
+		}
+		if err := c.Start(); err != nil {
+			logger.Panic(err.Error())
+		}
+	} else {
+		logger.With(slog.String("account", account.Name), slog.String("collector", collectorName)).Infof("collector disabled")
+	}
+
+	collectorName = "EscalationPolicy"
+	if Opts.ScrapeTime.EscalationPolicy.Seconds() > 0 {
+		c := collector.New(account.collectorName(collectorName), &MetricsCollectorEscalationPolicy{PagerDutyProcessor: newPagerDutyProcessor(account, collectorName, func(opts *config.Opts) time.Duration { return *opts.ScrapeTime.EscalationPolicy })}, account.logger())
+		c.SetScapeTime(*Opts.ScrapeTime.EscalationPolicy)
+		c.SetPanicThreshold(collectorPanicThreshold)
+		if err := c.SetCache(account.cachePath("escalationpolicy.json"), cacheTag); err != nil {
+			panic(err)
+		}
+		if err := c.Start(); err != nil {
+			logger.Panic(err.Error())
+		}
+	} else {
+		logger.With(slog.String("account", account.Name), slog.String("collector", collectorName)).Infof("collector disabled")
 	}
 
 	collectorName = "Schedule"
 	if Opts.ScrapeTime.Schedule.Seconds() > 0 {
-		c := collector.New(collectorName, &MetricsCollectorSchedule{}, logger.Slog())
+		c := collector.New(account.collectorName(collectorName), &MetricsCollectorSchedule{PagerDutyProcessor: newPagerDutyProcessor(account, collectorName, func(opts *config.Opts) time.Duration { return *opts.ScrapeTime.Schedule })}, account.logger())
 		c.SetScapeTime(*Opts.ScrapeTime.Schedule)
-		if err := c.SetCache(Opts.GetCachePath("schedule.json"), cacheTag); err != nil {
+		c.SetPanicThreshold(collectorPanicThreshold)
+		if err := c.SetCache(account.cachePath("schedule.json"), cacheTag); err != nil {
 			panic(err)
 		}
 		if err := c.Start(); err != nil {
 			logger.Panic(err.Error())
 		}
 	} else {
-		logger.With(slog.String("collector", collectorName)).Infof("collector disabled")
+		logger.With(slog.String("account", account.Name), slog.String("collector", collectorName)).Infof("collector disabled")
 	}
 
 	collectorName = "MaintenanceWindow"
 	if Opts.ScrapeTime.MaintenanceWindow.Seconds() > 0 {
-		c := collector.New(collectorName, &MetricsCollectorMaintenanceWindow{teamListOpt: Opts.PagerDuty.Teams.Filter}, logger.Slog())
+		c := collector.New(account.collectorName(collectorName), &MetricsCollectorMaintenanceWindow{PagerDutyProcessor: newPagerDutyProcessor(account, collectorName, func(opts *config.Opts) time.Duration { return *opts.ScrapeTime.MaintenanceWindow })}, account.logger())
 		c.SetScapeTime(*Opts.ScrapeTime.MaintenanceWindow)
-		if err := c.SetCache(Opts.GetCachePath("maintenancewindow.json"), cacheTag); err != nil {
+		c.SetPanicThreshold(collectorPanicThreshold)
+		if err := c.SetCache(account.cachePath("maintenancewindow.json"), cacheTag); err != nil {
 			panic(err)
 		}
 		if err := c.Start(); err != nil {
 			logger.Panic(err.Error())
 		}
 	} else {
-		logger.With(slog.String("collector", collectorName)).Infof("collector disabled")
+		logger.With(slog.String("account", account.Name), slog.String("collector", collectorName)).Infof("collector disabled")
 	}
 
 	collectorName = "OnCall"
 	if Opts.ScrapeTime.Live.Seconds() > 0 {
-		c := collector.New(collectorName, &MetricsCollectorOncall{}, logger.Slog())
+		c := collector.New(account.collectorName(collectorName), &MetricsCollectorOncall{PagerDutyProcessor: newPagerDutyProcessor(account, collectorName, func(opts *config.Opts) time.Duration { return opts.ScrapeTime.Live })}, account.logger())
 		c.SetScapeTime(Opts.ScrapeTime.Live)
-		if err := c.SetCache(Opts.GetCachePath("oncall.json"), cacheTag); err != nil {
+		c.SetPanicThreshold(collectorPanicThreshold)
+		if err := c.SetCache(account.cachePath("oncall.json"), cacheTag); err != nil {
 			panic(err)
 		}
 		if err := c.Start(); err != nil {
 			logger.Panic(err.Error())
 		}
 	} else {
-		logger.With(slog.String("collector", collectorName)).Infof("collector disabled")
+		logger.With(slog.String("account", account.Name), slog.String("collector", collectorName)).Infof("collector disabled")
 	}
 
 	collectorName = "Incident"
 	if Opts.ScrapeTime.Live.Seconds() > 0 {
-		c := collector.New(collectorName, &MetricsCollectorIncident{teamListOpt: Opts.PagerDuty.Teams.Filter}, logger.Slog())
+		incidentCollector := &MetricsCollectorIncident{PagerDutyProcessor: newPagerDutyProcessor(account, collectorName, func(opts *config.Opts) time.Duration { return opts.ScrapeTime.Live })}
+		c := collector.New(account.collectorName(collectorName), incidentCollector, account.logger())
 		c.SetScapeTime(Opts.ScrapeTime.Live)
-		if err := c.SetCache(Opts.GetCachePath("incident.json"), cacheTag); err != nil {
+		c.SetPanicThreshold(collectorPanicThreshold)
+		if err := c.SetCache(account.cachePath("incident.json"), cacheTag); err != nil {
 			panic(err)
 		}
 		if err := c.Start(); err != nil {
 			logger.Panic(err.Error())
 		}
+
+		if PagerDutyWebhook != nil {
+			PagerDutyWebhook.AddAccount(account, incidentCollector)
+		}
 	} else {
-		logger.With(slog.String("collector", collectorName)).Infof("collector disabled")
+		logger.With(slog.String("account", account.Name), slog.String("collector", collectorName)).Infof("collector disabled")
+		if len(Opts.PagerDuty.Webhook.Secrets) > 0 {
+			logger.Warn("PagerDuty webhook receiver requires the incident collector, webhook disabled")
+		}
+	}
+
+	collectorName = "BusinessServiceImpact"
+	if Opts.ScrapeTime.Live.Seconds() > 0 && Opts.ScrapeTime.BusinessService.Seconds() > 0 {
+		c := collector.New(account.collectorName(collectorName), &MetricsCollectorBusinessServiceImpact{PagerDutyProcessor: newPagerDutyProcessor(account, collectorName, func(opts *config.Opts) time.Duration { return opts.ScrapeTime.Live })}, account.logger())
+		c.SetScapeTime(Opts.ScrapeTime.Live)
+		c.SetPanicThreshold(collectorPanicThreshold)
+		if err := c.SetCache(account.cachePath("businessserviceimpact.json"), cacheTag); err != nil {
+			panic(err)
+		}
+		if err := c.Start(); err != nil {
+			logger.Panic(err.Error())
+		}
+	} else {
+		logger.With(slog.String("account", account.Name), slog.String("collector", collectorName)).Infof("collector disabled")
 	}
 
 	collectorName = "Summary"
 	if Opts.ScrapeTime.Summary.Seconds() > 0 {
-		c := collector.New(collectorName, &MetricsCollectorSummary{teamListOpt: Opts.PagerDuty.Teams.Filter}, logger.Slog())
+		// the state tag doesn't include the version, so the incident state survives updates of the exporter
+		stateTag := collector.BuildCacheTag(summaryStateVersion, account.Name, account.currentSettings().TeamFilter, Opts.PagerDuty.Summary)
+		stateFile, err := newStateFile(account.cacheName("summary.state.json"))
+		if err != nil {
+			panic(err)
+		}
+		c := collector.New(account.collectorName(collectorName), &MetricsCollectorSummary{PagerDutyProcessor: newPagerDutyProcessor(account, collectorName, func(opts *config.Opts) time.Duration { return opts.ScrapeTime.Summary }), stateFile: stateFile, stateTag: *stateTag}, account.logger())
 		c.SetScapeTime(Opts.ScrapeTime.Summary)
-		if err := c.SetCache(Opts.GetCachePath("summary.json"), cacheTag); err != nil {
+		c.SetPanicThreshold(collectorPanicThreshold)
+		if err := c.SetCache(account.cachePath("summary.json"), cacheTag); err != nil {
 			panic(err)
 		}
 		if err := c.Start(); err != nil {
 			logger.Panic(err.Error())
 		}
 	} else {
-		logger.With(slog.String("collector", collectorName)).Infof("collector disabled")
+		logger.With(slog.String("account", account.Name), slog.String("collector", collectorName)).Infof("collector disabled")
+	}
+
+	collectorName = "Analytics"
+	if Opts.ScrapeTime.Analytics.Seconds() > 0 {
+		c := collector.New(account.collectorName(collectorName), &MetricsCollectorAnalytics{PagerDutyProcessor: newPagerDutyProcessor(account, collectorName, func(opts *config.Opts) time.Duration { return opts.ScrapeTime.Analytics })}, account.logger())
+		c.SetScapeTime(Opts.ScrapeTime.Analytics)
+		c.SetPanicThreshold(collectorPanicThreshold)
+		if err := c.SetCache(account.cachePath("analytics.json"), cacheTag); err != nil {
+			panic(err)
+		}
+		if err := c.Start(); err != nil {
+			logger.Panic(err.Error())
+		}
+	} else {
+		logger.With(slog.String("account", account.Name), slog.String("collector", collectorName)).Infof("collector disabled")
+	}
+
+	collectorName = "Timeline"
+	if Opts.ScrapeTime.Timeline.Seconds() > 0 {
+		c := collector.New(account.collectorName(collectorName), &MetricsCollectorTimeline{PagerDutyProcessor: newPagerDutyProcessor(account, collectorName, func(opts *config.Opts) time.Duration { return opts.ScrapeTime.Timeline })}, account.logger())
+		c.SetScapeTime(Opts.ScrapeTime.Timeline)
+		c.SetPanicThreshold(collectorPanicThreshold)
+		if err := c.SetCache(account.cachePath("timeline.json"), cacheTag); err != nil {
+			panic(err)
+		}
+		if err := c.Start(); err != nil {
+			logger.Panic(err.Error())
+		}
+	} else {
+		logger.With(slog.String("account", account.Name), slog.String("collector", collectorName)).Infof("collector disabled")
+	}
+
+	collectorName = "LogStream"
+	if Opts.ScrapeTime.LogStream.Seconds() > 0 {
+		// counters are persisted in the state, the state tag doesn't include the version so counters survive updates
+		stateTag := collector.BuildCacheTag(logStreamStateVersion, account.Name, account.currentSettings().TeamFilter)
+		stateFile, err := newStateFile(account.cacheName("logstream.state.json"))
+		if err != nil {
+			panic(err)
+		}
+		c := collector.New(account.collectorName(collectorName), &MetricsCollectorLogStream{PagerDutyProcessor: newPagerDutyProcessor(account, collectorName, func(opts *config.Opts) time.Duration { return opts.ScrapeTime.LogStream }), stateFile: stateFile, stateTag: *stateTag}, account.logger())
+		c.SetScapeTime(Opts.ScrapeTime.LogStream)
+		c.SetPanicThreshold(collectorPanicThreshold)
+		if err := c.Start(); err != nil {
+			logger.Panic(err.Error())
+		}
+	} else {
+		logger.With(slog.String("account", account.Name), slog.String("collector", collectorName)).Infof("collector disabled")
 	}
 
 	collectorName = "System"
 	if Opts.ScrapeTime.System.Seconds() > 0 {
-		c := collector.New(collectorName, &MetricsCollectorSystem{}, logger.Slog())
-		c.SetScapeTime(Opts.ScrapeTime.Summary)
-		if err := c.SetCache(Opts.GetCachePath("system.json"), cacheTag); err != nil {
+		c := collector.New(account.collectorName(collectorName), &MetricsCollectorSystem{PagerDutyProcessor: newPagerDutyProcessor(account, collectorName, func(opts *config.Opts) time.Duration { return opts.ScrapeTime.System })}, account.logger())
+		c.SetScapeTime(Opts.ScrapeTime.System)
+		c.SetPanicThreshold(collectorPanicThreshold)
+		if err := c.SetCache(account.cachePath("system.json"), cacheTag); err != nil {
 			panic(err)
 		}
 		if err := c.Start(); err != nil {
 			logger.Panic(err.Error())
 		}
 	} else {
-		logger.With(slog.String("collector", collectorName)).Infof("collector disabled")
+		logger.With(slog.String("account", account.Name), slog.String("collector", collectorName)).Infof("collector disabled")
 	}
 }
 
@@ -296,21 +503,27 @@ func initMetricCollector() {
 func startHTTPServer() {
 	mux := http.NewServeMux()
 
-	// healthz
-	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
-		if _, err := fmt.Fprint(w, "Ok"); err != nil {
-			logger.Error(err.Error())
-		}
-	})
+	// healthz (liveness): fails if a collector run is stuck
+	mux.HandleFunc("/healthz", healthHandler("stuck", func(status *collectorStatus) bool {
+		return !status.Stuck
+	}))
 
-	// readyz
-	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
-		if _, err := fmt.Fprint(w, "Ok"); err != nil {
-			logger.Error(err.Error())
-		}
-	})
+	// readyz (readiness): fails until all collectors have metrics (collected or restored from cache)
+	mux.HandleFunc("/readyz", healthHandler("not ready", func(status *collectorStatus) bool {
+		return status.Ready
+	}))
+
+	// metrics (bearer token protected)
+	metricsHandler, err := bearerTokenHandler(promhttp.Handler())
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+	mux.Handle("/metrics", metricsHandler)
 
-	mux.Handle("/metrics", promhttp.Handler())
+	// PagerDuty webhook
+	if PagerDutyWebhook != nil {
+		PagerDutyWebhook.Register(mux, Opts.PagerDuty.Webhook.Path)
+	}
 
 	srv := &http.Server{
 		Addr:         Opts.Server.Bind,
@@ -318,7 +531,7 @@ func startHTTPServer() {
 		ReadTimeout:  Opts.Server.ReadTimeout,
 		WriteTimeout: Opts.Server.WriteTimeout,
 	}
-	if err := srv.ListenAndServe(); err != nil {
+	if err := serveHTTP(srv); err != nil {
 		logger.Fatal(err.Error())
 	}
 }
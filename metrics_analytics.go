@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/PagerDuty/go-pagerduty"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/webdevops/go-common/prometheus/collector"
+)
+
+type (
+	MetricsCollectorAnalytics struct {
+		PagerDutyProcessor
+
+		prometheus struct {
+			analytics              map[string]*prometheus.GaugeVec
+			analyticsInterruptions *prometheus.GaugeVec
+		}
+	}
+
+	analyticsMetric struct {
+		name  string
+		help  string
+		value func(data pagerduty.AnalyticsData) float64
+	}
+)
+
+var (
+	analyticsMetrics = []analyticsMetric{
+		{
+			name:  "pagerduty_analytics_incident_count",
+			help:  "PagerDuty analytics total incident count",
+			value: func(data pagerduty.AnalyticsData) float64 { return float64(data.TotalIncidentCount) },
+		},
+		{
+			name:  "pagerduty_analytics_mean_seconds_to_resolve",
+			help:  "PagerDuty analytics mean time to resolve (seconds)",
+			value: func(data pagerduty.AnalyticsData) float64 { return float64(data.MeanSecondsToResolve) },
+		},
+		{
+			name:  "pagerduty_analytics_mean_seconds_to_first_ack",
+			help:  "PagerDuty analytics mean time to first acknowledge (seconds)",
+			value: func(data pagerduty.AnalyticsData) float64 { return float64(data.MeanSecondsToFirstAck) },
+		},
+		{
+			name:  "pagerduty_analytics_mean_seconds_to_engage",
+			help:  "PagerDuty analytics mean time to engage (seconds)",
+			value: func(data pagerduty.AnalyticsData) float64 { return float64(data.MeanSecondsToEngage) },
+		},
+		{
+			name:  "pagerduty_analytics_mean_seconds_to_mobilize",
+			help:  "PagerDuty analytics mean time to mobilize (seconds)",
+			value: func(data pagerduty.AnalyticsData) float64 { return float64(data.MeanSecondsToMobilize) },
+		},
+		{
+			name:  "pagerduty_analytics_mean_engaged_seconds",
+			help:  "PagerDuty analytics mean engaged time (seconds)",
+			value: func(data pagerduty.AnalyticsData) float64 { return float64(data.MeanEngagedSeconds) },
+		},
+		{
+			name:  "pagerduty_analytics_mean_engaged_user_count",
+			help:  "PagerDuty analytics mean engaged user count",
+			value: func(data pagerduty.AnalyticsData) float64 { return float64(data.MeanEngagedUserCount) },
+		},
+		{
+			name:  "pagerduty_analytics_mean_assignment_count",
+			help:  "PagerDuty analytics mean assignment count",
+			value: func(data pagerduty.AnalyticsData) float64 { return float64(data.MeanAssignmentCount) },
+		},
+		{
+			name:  "pagerduty_analytics_escalation_count",
+			help:  "PagerDuty analytics total escalation count",
+			value: func(data pagerduty.AnalyticsData) float64 { return float64(data.TotalEscalationCount) },
+		},
+		{
+			name:  "pagerduty_analytics_snoozed_seconds",
+			help:  "PagerDuty analytics total snoozed time (seconds)",
+			value: func(data pagerduty.AnalyticsData) float64 { return float64(data.TotalSnoozedSeconds) },
+		},
+		{
+			name:  "pagerduty_analytics_engaged_seconds",
+			help:  "PagerDuty analytics total engaged time (seconds)",
+			value: func(data pagerduty.AnalyticsData) float64 { return float64(data.TotalEngagedSeconds) },
+		},
+		{
+			name:  "pagerduty_analytics_uptime_percentage",
+			help:  "PagerDuty analytics service uptime percentage",
+			value: func(data pagerduty.AnalyticsData) float64 { return data.UpTimePct },
+		},
+	}
+)
+
+func (m *MetricsCollectorAnalytics) Setup(collector *collector.Collector) {
+	m.Processor.Setup(collector)
+
+	m.prometheus.analytics = map[string]*prometheus.GaugeVec{}
+	for _, metric := range analyticsMetrics {
+		m.prometheus.analytics[metric.name] = prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name:        metric.name,
+				Help:        metric.help,
+				ConstLabels: m.constLabels(),
+			},
+			[]string{
+				"scope",
+				"serviceID",
+				"teamID",
+				"rangeStart",
+			},
+		)
+		m.registerMetricList(metric.name, m.prometheus.analytics[metric.name], true)
+	}
+
+	m.prometheus.analyticsInterruptions = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "pagerduty_analytics_interruptions",
+			Help:        "PagerDuty analytics total interruptions by period (business, off, sleep hours)",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{
+			"scope",
+			"serviceID",
+			"teamID",
+			"rangeStart",
+			"period",
+		},
+	)
+	m.registerMetricList("pagerduty_analytics_interruptions", m.prometheus.analyticsInterruptions, true)
+}
+
+func (m *MetricsCollectorAnalytics) Collect(callback chan<- func()) {
+	m.run(func() error {
+		return m.collectAnalytics(callback)
+	})
+}
+
+func (m *MetricsCollectorAnalytics) collectAnalytics(callback chan<- func()) error {
+	now := time.Now().UTC()
+
+	request := pagerduty.AnalyticsRequest{
+		Filters: &pagerduty.AnalyticsFilter{
+			CreatedAtStart: now.Add(-m.opts.PagerDuty.Analytics.Since).Format(time.RFC3339),
+			CreatedAtEnd:   now.Format(time.RFC3339),
+		},
+		AggregateUnit: m.opts.PagerDuty.Analytics.AggregateUnit,
+		TimeZone:      m.opts.PagerDuty.Analytics.TimeZone,
+	}
+
+	if len(m.teamListOpt()) > 0 {
+		request.Filters.TeamIDs = m.teamListOpt()
+	}
+
+	scopes := []struct {
+		scope    string
+		endpoint string
+		fetch    func(ctx context.Context, request pagerduty.AnalyticsRequest) (pagerduty.AnalyticsResponse, error)
+	}{
+		{scope: "all", endpoint: "GetAggregatedIncidentData", fetch: m.client().GetAggregatedIncidentData},
+		{scope: "service", endpoint: "GetAggregatedServiceData", fetch: m.client().GetAggregatedServiceData},
+		{scope: "team", endpoint: "GetAggregatedTeamData", fetch: m.client().GetAggregatedTeamData},
+	}
+
+	interruptionsMetricList := m.Collector.GetMetricList("pagerduty_analytics_interruptions")
+
+	for _, scope := range scopes {
+		m.Logger().Debug("fetch analytics", slog.String("scope", scope.scope), slog.String("since", request.Filters.CreatedAtStart), slog.String("until", request.Filters.CreatedAtEnd))
+
+		resp, err := scope.fetch(m.Context(), request)
+		PrometheusPagerDutyApiCounter.WithLabelValues(m.account.Name, scope.endpoint).Inc()
+		if err != nil {
+			// eg. team analytics are not available on all plans
+			if err := m.handleError(scope.endpoint, err); isAbortError(err) {
+				return err
+			}
+			continue
+		}
+
+		for _, data := range resp.Data {
+			labels := prometheus.Labels{
+				"scope":      scope.scope,
+				"serviceID":  data.ServiceID,
+				"teamID":     data.TeamID,
+				"rangeStart": data.RangeStart,
+			}
+
+			for _, metric := range analyticsMetrics {
+				m.Collector.GetMetricList(metric.name).Add(labels, metric.value(data))
+			}
+
+			for period, value := range map[string]int{
+				"business": data.TotalBusinessHourInterruptions,
+				"off":      data.TotalOffHourInterruptions,
+				"sleep":    data.TotalSleepHourInterruptions,
+			} {
+				interruptionsMetricList.Add(prometheus.Labels{
+					"scope":      scope.scope,
+					"serviceID":  data.ServiceID,
+					"teamID":     data.TeamID,
+					"rangeStart": data.RangeStart,
+					"period":     period,
+				}, float64(value))
+			}
+		}
+	}
+
+	return nil
+}
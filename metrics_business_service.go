@@ -0,0 +1,179 @@
+package main
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+
+	"github.com/PagerDuty/go-pagerduty"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/webdevops/go-common/prometheus/collector"
+)
+
+type MetricsCollectorBusinessService struct {
+	PagerDutyProcessor
+
+	prometheus struct {
+		businessService   *prometheus.GaugeVec
+		serviceDependency *prometheus.GaugeVec
+	}
+}
+
+func (m *MetricsCollectorBusinessService) Setup(collector *collector.Collector) {
+	m.Processor.Setup(collector)
+
+	m.prometheus.businessService = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "pagerduty_business_service_info",
+			Help:        "PagerDuty business service",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{
+			"businessServiceID",
+			"teamID",
+			"businessServiceName",
+			"businessServiceUrl",
+			"pointOfContact",
+		},
+	)
+	m.registerMetricList("pagerduty_business_service_info", m.prometheus.businessService, true)
+
+	m.prometheus.serviceDependency = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "pagerduty_service_dependency",
+			Help:        "PagerDuty service dependency (dependent service depends on supporting service)",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{
+			"supportingServiceID",
+			"dependentServiceID",
+			"kind",
+		},
+	)
+	m.registerMetricList("pagerduty_service_dependency", m.prometheus.serviceDependency, true)
+}
+
+func (m *MetricsCollectorBusinessService) Collect(callback chan<- func()) {
+	m.run(func() error {
+		return m.collectBusinessServices(callback)
+	})
+}
+
+func (m *MetricsCollectorBusinessService) collectBusinessServices(callback chan<- func()) error {
+	listOpts := pagerduty.ListBusinessServiceOptions{}
+	listOpts.Limit = PagerdutyListLimit
+
+	businessServiceMetricList := m.Collector.GetMetricList("pagerduty_business_service_info")
+
+	m.Logger().Debug("fetch business services")
+
+	list, err := m.client().ListBusinessServicesPaginated(m.Context(), listOpts)
+	PrometheusPagerDutyApiCounter.WithLabelValues(m.account.Name, "ListBusinessServices").Inc()
+	if err != nil {
+		return m.handleError("ListBusinessServices", err)
+	}
+
+	// relationships are returned for both services, each dependency must only be exported once
+	dependencies := map[string]bool{}
+
+	for _, businessService := range list {
+		teamID := ""
+		if businessService.Team != nil {
+			teamID = businessService.Team.ID
+		}
+
+		if len(m.teamListOpt()) > 0 && !slices.Contains(m.teamListOpt(), teamID) {
+			continue
+		}
+
+		businessServiceMetricList.AddInfo(prometheus.Labels{
+			"businessServiceID":   businessService.ID,
+			"teamID":              teamID,
+			"businessServiceName": businessService.Name,
+			"businessServiceUrl":  businessService.HTMLUrl,
+			"pointOfContact":      businessService.PointOfContact,
+		})
+
+		relationships, err := m.client().ListBusinessServiceDependenciesWithContext(m.Context(), businessService.ID)
+		PrometheusPagerDutyApiCounter.WithLabelValues(m.account.Name, "ListBusinessServiceDependencies").Inc()
+		if err != nil {
+			if err := m.handleError("ListBusinessServiceDependencies", err); isAbortError(err) {
+				return err
+			}
+			continue
+		}
+		m.addServiceDependencies(relationships, dependencies)
+	}
+
+	return m.collectTechnicalServiceDependencies(dependencies)
+}
+
+func (m *MetricsCollectorBusinessService) collectTechnicalServiceDependencies(dependencies map[string]bool) error {
+	listOpts := pagerduty.ListServiceOptions{}
+	listOpts.Limit = PagerdutyListLimit
+	listOpts.Offset = 0
+
+	if len(m.teamListOpt()) > 0 {
+		listOpts.TeamIDs = m.teamListOpt()
+	}
+
+	for {
+		m.Logger().Debug("fetch services", slog.Uint64("offset", uint64(listOpts.Offset)), slog.Uint64("limit", uint64(listOpts.Limit)))
+
+		list, err := m.client().ListServicesWithContext(m.Context(), listOpts)
+		PrometheusPagerDutyApiCounter.WithLabelValues(m.account.Name, "ListServices").Inc()
+		if err != nil {
+			return m.handleError("ListServices", err)
+		}
+
+		for _, service := range list.Services {
+			relationships, err := m.client().ListTechnicalServiceDependenciesWithContext(m.Context(), service.ID)
+			PrometheusPagerDutyApiCounter.WithLabelValues(m.account.Name, "ListTechnicalServiceDependencies").Inc()
+			if err != nil {
+				if err := m.handleError("ListTechnicalServiceDependencies", err); isAbortError(err) {
+					return err
+				}
+				continue
+			}
+			m.addServiceDependencies(relationships, dependencies)
+		}
+
+		listOpts.Offset += list.Limit
+		if stopPagerdutyPaging(list.APIListObject) {
+			break
+		}
+	}
+
+	return nil
+}
+
+// addServiceDependencies adds the (not yet exported) dependencies to the metric list
+func (m *MetricsCollectorBusinessService) addServiceDependencies(relationships *pagerduty.ListServiceDependencies, dependencies map[string]bool) {
+	serviceDependencyMetricList := m.Collector.GetMetricList("pagerduty_service_dependency")
+
+	for _, relationship := range relationships.Relationships {
+		if relationship.SupportingService == nil || relationship.DependentService == nil {
+			continue
+		}
+
+		key := relationship.DependentService.ID + "/" + relationship.SupportingService.ID
+		if dependencies[key] {
+			continue
+		}
+		dependencies[key] = true
+
+		serviceDependencyMetricList.AddInfo(prometheus.Labels{
+			"supportingServiceID": relationship.SupportingService.ID,
+			"dependentServiceID":  relationship.DependentService.ID,
+			"kind":                serviceDependencyKind(relationship.DependentService) + "_to_" + serviceDependencyKind(relationship.SupportingService),
+		})
+	}
+}
+
+// serviceDependencyKind returns "business" for business services and "technical" for all other services
+func serviceDependencyKind(service *pagerduty.ServiceObj) string {
+	if strings.HasPrefix(service.Type, "business_service") {
+		return "business"
+	}
+	return "technical"
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"log/slog"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/PagerDuty/go-pagerduty"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/webdevops/go-common/prometheus/collector"
+)
+
+const (
+	// business service impact endpoints are only available as early access
+	PagerDutyBusinessImpactEarlyAccess = "business-impact-early-access"
+)
+
+type (
+	MetricsCollectorBusinessServiceImpact struct {
+		PagerDutyProcessor
+
+		prometheus struct {
+			impactStatus      *prometheus.GaugeVec
+			impactingIncident *prometheus.GaugeVec
+		}
+
+		// impacting incidents are only counted every incident interval (one API request per incident)
+		impactingIncidents     map[string]float64
+		impactingIncidentsTime time.Time
+	}
+
+	pagerdutyBusinessServiceImpact struct {
+		ID               string `json:"id"`
+		Status           string `json:"status"`
+		AdditionalFields struct {
+			HighestImpactingPriority *struct {
+				ID    string `json:"id"`
+				Order int    `json:"order"`
+			} `json:"highest_impacting_priority"`
+		} `json:"additional_fields"`
+	}
+
+	pagerdutyBusinessServiceImpactList struct {
+		pagerduty.APIListObject
+		Services []pagerdutyBusinessServiceImpact `json:"services"`
+	}
+)
+
+func (m *MetricsCollectorBusinessServiceImpact) Setup(collector *collector.Collector) {
+	m.Processor.Setup(collector)
+
+	m.prometheus.impactStatus = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "pagerduty_business_service_impact_status",
+			Help:        "PagerDuty business service impact status (impacted or not_impacted)",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{
+			"businessServiceID",
+			"status",
+			"highestImpactingPriorityID",
+		},
+	)
+	m.registerMetricList("pagerduty_business_service_impact_status", m.prometheus.impactStatus, true)
+
+	m.prometheus.impactingIncident = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "pagerduty_business_service_impacting_incidents",
+			Help:        "PagerDuty count of open incidents impacting the business service",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{
+			"businessServiceID",
+		},
+	)
+	m.registerMetricList("pagerduty_business_service_impacting_incidents", m.prometheus.impactingIncident, true)
+}
+
+func (m *MetricsCollectorBusinessServiceImpact) Collect(callback chan<- func()) {
+	m.run(func() error {
+		return m.collectBusinessServiceImpacts(callback)
+	})
+}
+
+func (m *MetricsCollectorBusinessServiceImpact) collectBusinessServiceImpacts(callback chan<- func()) error {
+	impactStatusMetricList := m.Collector.GetMetricList("pagerduty_business_service_impact_status")
+	impactingIncidentMetricList := m.Collector.GetMetricList("pagerduty_business_service_impacting_incidents")
+
+	businessServiceIDs, err := m.teamBusinessServiceIDs()
+	if err != nil {
+		return err
+	}
+
+	businessServices := map[string]bool{}
+
+	query := url.Values{}
+	query.Add("additional_fields[]", "services.highest_impacting_priority")
+	query.Set("limit", strconv.Itoa(PagerdutyListLimit))
+	offset := uint(0)
+	for {
+		query.Set("offset", strconv.FormatUint(uint64(offset), 10))
+
+		m.Logger().Debug("fetch business service impacts", slog.Uint64("offset", uint64(offset)), slog.Uint64("limit", uint64(PagerdutyListLimit)))
+
+		list := pagerdutyBusinessServiceImpactList{}
+		PrometheusPagerDutyApiCounter.WithLabelValues(m.account.Name, "ListBusinessServiceImpacts").Inc()
+		if err := m.account.apiGet(m.Context(), "/business_services/impacts", query, businessImpactHeaders(), &list); err != nil {
+			return m.handleError("ListBusinessServiceImpacts", err)
+		}
+
+		for _, impact := range list.Services {
+			if businessServiceIDs != nil && !businessServiceIDs[impact.ID] {
+				continue
+			}
+
+			priorityID := ""
+			if impact.AdditionalFields.HighestImpactingPriority != nil {
+				priorityID = impact.AdditionalFields.HighestImpactingPriority.ID
+			}
+
+			impactStatusMetricList.AddInfo(prometheus.Labels{
+				"businessServiceID":          impact.ID,
+				"status":                     impact.Status,
+				"highestImpactingPriorityID": priorityID,
+			})
+			businessServices[impact.ID] = true
+		}
+
+		offset += PagerdutyListLimit
+		if !list.More || len(list.Services) == 0 {
+			break
+		}
+	}
+
+	if m.opts.PagerDuty.BusinessServiceImpact.IncidentLimit == 0 {
+		return nil
+	}
+
+	if m.impactingIncidents == nil || time.Since(m.impactingIncidentsTime) >= m.opts.PagerDuty.BusinessServiceImpact.IncidentInterval {
+		impactingIncidents, err := m.countImpactingIncidents()
+		if err != nil {
+			return err
+		}
+		m.impactingIncidents = impactingIncidents
+		m.impactingIncidentsTime = time.Now()
+	}
+
+	for businessServiceID := range businessServices {
+		impactingIncidentMetricList.Add(prometheus.Labels{
+			"businessServiceID": businessServiceID,
+		}, m.impactingIncidents[businessServiceID])
+	}
+
+	return nil
+}
+
+// teamBusinessServiceIDs returns the IDs of the business services of the team filter (nil if no team filter is set)
+func (m *MetricsCollectorBusinessServiceImpact) teamBusinessServiceIDs() (map[string]bool, error) {
+	if len(m.teamListOpt()) == 0 {
+		return nil, nil
+	}
+
+	listOpts := pagerduty.ListBusinessServiceOptions{}
+	listOpts.Limit = PagerdutyListLimit
+
+	list, err := m.client().ListBusinessServicesPaginated(m.Context(), listOpts)
+	PrometheusPagerDutyApiCounter.WithLabelValues(m.account.Name, "ListBusinessServices").Inc()
+	if err != nil {
+		return nil, m.handleError("ListBusinessServices", err)
+	}
+
+	ret := map[string]bool{}
+	for _, businessService := range list {
+		if businessService.Team != nil && slices.Contains(m.teamListOpt(), businessService.Team.ID) {
+			ret[businessService.ID] = true
+		}
+	}
+	return ret, nil
+}
+
+// countImpactingIncidents counts the newest open incidents (up to the incident limit) impacting the business services
+func (m *MetricsCollectorBusinessServiceImpact) countImpactingIncidents() (map[string]float64, error) {
+	incidentLimit := m.opts.PagerDuty.BusinessServiceImpact.IncidentLimit
+	impactingIncidents := map[string]float64{}
+
+	listOpts := pagerduty.ListIncidentsOptions{}
+	listOpts.Limit = min(PagerdutyListLimit, incidentLimit)
+	listOpts.Statuses = []string{"triggered", "acknowledged"}
+	listOpts.Offset = 0
+	listOpts.SortBy = "created_at:desc"
+
+	if len(m.teamListOpt()) > 0 {
+		listOpts.TeamIDs = m.teamListOpt()
+	}
+
+	for {
+		m.Logger().Debug("fetch open incidents", slog.Uint64("offset", uint64(listOpts.Offset)), slog.Uint64("limit", uint64(listOpts.Limit)))
+
+		list, err := m.client().ListIncidentsWithContext(m.Context(), listOpts)
+		PrometheusPagerDutyApiCounter.WithLabelValues(m.account.Name, "ListIncidents").Inc()
+		if err != nil {
+			return nil, m.handleError("ListIncidents", err)
+		}
+
+		for _, incident := range list.Incidents {
+			impacts := pagerdutyBusinessServiceImpactList{}
+			PrometheusPagerDutyApiCounter.WithLabelValues(m.account.Name, "ListIncidentBusinessServiceImpacts").Inc()
+			if err := m.account.apiGet(m.Context(), "/incidents/"+url.PathEscape(incident.ID)+"/business_services/impacts", nil, businessImpactHeaders(), &impacts); err != nil {
+				if err := m.handleError("ListIncidentBusinessServiceImpacts", err); isAbortError(err) {
+					return nil, err
+				}
+				continue
+			}
+
+			for _, impact := range impacts.Services {
+				if impact.Status == "impacted" {
+					impactingIncidents[impact.ID]++
+				}
+			}
+		}
+
+		listOpts.Offset += listOpts.Limit
+		if stopPagerdutyPaging(list.APIListObject) {
+			break
+		}
+		if listOpts.Offset >= incidentLimit {
+			m.Logger().Info("incident limit for business service impacts reached, older open incidents are not counted", slog.Uint64("limit", uint64(incidentLimit)))
+			break
+		}
+		listOpts.Limit = min(PagerdutyListLimit, incidentLimit-listOpts.Offset)
+	}
+
+	return impactingIncidents, nil
+}
+
+func businessImpactHeaders() map[string]string {
+	return map[string]string{
+		"X-EARLY-ACCESS": PagerDutyBusinessImpactEarlyAccess,
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"log/slog"
+	"strconv"
+
+	"github.com/PagerDuty/go-pagerduty"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/webdevops/go-common/prometheus/collector"
+)
+
+type MetricsCollectorEscalationPolicy struct {
+	PagerDutyProcessor
+
+	prometheus struct {
+		escalationPolicy           *prometheus.GaugeVec
+		escalationPolicyLoops      *prometheus.GaugeVec
+		escalationPolicyRule       *prometheus.GaugeVec
+		escalationPolicyRuleTarget *prometheus.GaugeVec
+		escalationPolicyService    *prometheus.GaugeVec
+	}
+}
+
+func (m *MetricsCollectorEscalationPolicy) Setup(collector *collector.Collector) {
+	m.Processor.Setup(collector)
+
+	m.prometheus.escalationPolicy = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "pagerduty_escalation_policy_info",
+			Help:        "PagerDuty escalation policy",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{
+			"escalationPolicyID",
+			"teamID",
+			"escalationPolicyName",
+			"escalationPolicyUrl",
+		},
+	)
+	m.registerMetricList("pagerduty_escalation_policy_info", m.prometheus.escalationPolicy, true)
+
+	m.prometheus.escalationPolicyLoops = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "pagerduty_escalation_policy_loops",
+			Help:        "PagerDuty escalation policy number of loops",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{
+			"escalationPolicyID",
+		},
+	)
+	m.registerMetricList("pagerduty_escalation_policy_loops", m.prometheus.escalationPolicyLoops, true)
+
+	m.prometheus.escalationPolicyRule = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "pagerduty_escalation_policy_rule_delay_minutes",
+			Help:        "PagerDuty escalation policy rule escalation delay in minutes",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{
+			"escalationPolicyID",
+			"ruleID",
+			"escalationLevel",
+		},
+	)
+	m.registerMetricList("pagerduty_escalation_policy_rule_delay_minutes", m.prometheus.escalationPolicyRule, true)
+
+	m.prometheus.escalationPolicyRuleTarget = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "pagerduty_escalation_policy_rule_target",
+			Help:        "PagerDuty escalation policy rule target (schedule or user)",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{
+			"escalationPolicyID",
+			"ruleID",
+			"escalationLevel",
+			"scheduleID",
+			"userID",
+			"type",
+		},
+	)
+	m.registerMetricList("pagerduty_escalation_policy_rule_target", m.prometheus.escalationPolicyRuleTarget, true)
+
+	m.prometheus.escalationPolicyService = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "pagerduty_escalation_policy_service",
+			Help:        "PagerDuty escalation policy to service link",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{
+			"escalationPolicyID",
+			"serviceID",
+		},
+	)
+	m.registerMetricList("pagerduty_escalation_policy_service", m.prometheus.escalationPolicyService, true)
+}
+
+func (m *MetricsCollectorEscalationPolicy) Collect(callback chan<- func()) {
+	m.run(func() error {
+		return m.collectEscalationPolicies(callback)
+	})
+}
+
+func (m *MetricsCollectorEscalationPolicy) collectEscalationPolicies(callback chan<- func()) error {
+	listOpts := pagerduty.ListEscalationPoliciesOptions{}
+	listOpts.Limit = PagerdutyListLimit
+	listOpts.Offset = 0
+
+	if len(m.teamListOpt()) > 0 {
+		listOpts.TeamIDs = m.teamListOpt()
+	}
+
+	escalationPolicyMetricList := m.Collector.GetMetricList("pagerduty_escalation_policy_info")
+	escalationPolicyLoopsMetricList := m.Collector.GetMetricList("pagerduty_escalation_policy_loops")
+	escalationPolicyRuleMetricList := m.Collector.GetMetricList("pagerduty_escalation_policy_rule_delay_minutes")
+	escalationPolicyRuleTargetMetricList := m.Collector.GetMetricList("pagerduty_escalation_policy_rule_target")
+	escalationPolicyServiceMetricList := m.Collector.GetMetricList("pagerduty_escalation_policy_service")
+
+	for {
+		m.Logger().Debug("fetch escalation policies", slog.Uint64("offset", uint64(listOpts.Offset)), slog.Uint64("limit", uint64(listOpts.Limit)))
+
+		list, err := m.client().ListEscalationPoliciesWithContext(m.Context(), listOpts)
+		PrometheusPagerDutyApiCounter.WithLabelValues(m.account.Name, "ListEscalationPolicies").Inc()
+		if err != nil {
+			return m.handleError("ListEscalationPolicies", err)
+		}
+
+		for _, policy := range list.EscalationPolicies {
+			if len(policy.Teams) > 0 {
+				for _, team := range policy.Teams {
+					escalationPolicyMetricList.AddInfo(prometheus.Labels{
+						"escalationPolicyID":   policy.ID,
+						"teamID":               team.ID,
+						"escalationPolicyName": policy.Name,
+						"escalationPolicyUrl":  policy.HTMLURL,
+					})
+				}
+			} else {
+				escalationPolicyMetricList.AddInfo(prometheus.Labels{
+					"escalationPolicyID":   policy.ID,
+					"teamID":               "",
+					"escalationPolicyName": policy.Name,
+					"escalationPolicyUrl":  policy.HTMLURL,
+				})
+			}
+
+			escalationPolicyLoopsMetricList.Add(prometheus.Labels{
+				"escalationPolicyID": policy.ID,
+			}, float64(policy.NumLoops))
+
+			// rules (escalation level is 1-based, same as in oncall)
+			for ruleIndex, rule := range policy.EscalationRules {
+				escalationLevel := strconv.Itoa(ruleIndex + 1)
+
+				escalationPolicyRuleMetricList.Add(prometheus.Labels{
+					"escalationPolicyID": policy.ID,
+					"ruleID":             rule.ID,
+					"escalationLevel":    escalationLevel,
+				}, float64(rule.Delay))
+
+				for _, target := range rule.Targets {
+					scheduleID := ""
+					userID := ""
+					targetType := ""
+
+					switch target.Type {
+					case "schedule", "schedule_reference":
+						scheduleID = target.ID
+						targetType = "schedule"
+					case "user", "user_reference":
+						userID = target.ID
+						targetType = "user"
+					default:
+						targetType = target.Type
+					}
+
+					escalationPolicyRuleTargetMetricList.AddInfo(prometheus.Labels{
+						"escalationPolicyID": policy.ID,
+						"ruleID":             rule.ID,
+						"escalationLevel":    escalationLevel,
+						"scheduleID":         scheduleID,
+						"userID":             userID,
+						"type":               targetType,
+					})
+				}
+			}
+
+			// services
+			for _, service := range policy.Services {
+				escalationPolicyServiceMetricList.AddInfo(prometheus.Labels{
+					"escalationPolicyID": policy.ID,
+					"serviceID":          service.ID,
+				})
+			}
+		}
+
+		listOpts.Offset += list.Limit
+		if stopPagerdutyPaging(list.APIListObject) {
+			break
+		}
+	}
+
+	return nil
+}
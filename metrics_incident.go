@@ -2,31 +2,78 @@ package main
 
 import (
 	"log/slog"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/PagerDuty/go-pagerduty"
 	"github.com/prometheus/client_golang/prometheus"
+	prometheusCommon "github.com/webdevops/go-common/prometheus"
 	"github.com/webdevops/go-common/prometheus/collector"
+
+	"github.com/webdevops/pagerduty-exporter/config"
 )
 
 type MetricsCollectorIncident struct {
-	collector.Processor
+	PagerDutyProcessor
 
 	prometheus struct {
 		incident       *prometheus.GaugeVec
+		incidentTeam   *prometheus.GaugeVec
 		incidentStatus *prometheus.GaugeVec
+
+		incidentOpenCount           *prometheus.GaugeVec
+		incidentOpenOldestAge       *prometheus.GaugeVec
+		incidentUnacknowledgedCount *prometheus.GaugeVec
+		incidentListTruncated       *prometheus.GaugeVec
+
+		incidentAlertCount *prometheus.GaugeVec
+		incidentAlert      *prometheus.GaugeVec
 	}
 
-	teamListOpt []string
+	// lookups of the last run, also used for incidents received via webhook
+	lookupLock sync.RWMutex
+	// priority order (1 is the highest priority) per priority ID, refreshed every general scrape time
+	priorityOrder     map[string]int
+	priorityOrderTime time.Time
+	// escalation level per open incident ID
+	escalationLevels map[string]incidentEscalationLevel
+	// open incidents of the last run (nil before the first run), updated by the webhook receiver
+	openIncidents *incidentAggregates
+}
+
+// incidentEscalationLevel is the escalation level of an incident and the state of the incident it was fetched for
+type incidentEscalationLevel struct {
+	key   string
+	level string
+}
+
+var (
+	// incidentOpenStatuses are the statuses of open incidents (sorted)
+	incidentOpenStatuses = []string{"acknowledged", "triggered"}
+
+	escalateLogEntryLevelRegexp = regexp.MustCompile(`(?i)\blevel\s+([0-9]+)`)
+)
+
+// incidentAggregates are the open incidents (only the fields of the aggregates) per incident ID, used for the
+// low cardinality aggregates of the open incidents
+type incidentAggregates struct {
+	incidents map[string]pagerduty.Incident
 }
 
 func (m *MetricsCollectorIncident) Setup(collector *collector.Collector) {
 	m.Processor.Setup(collector)
 
+	m.escalationLevels = map[string]incidentEscalationLevel{}
+
 	m.prometheus.incident = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "pagerduty_incident_info",
-			Help: "PagerDuty incident",
+			Name:        "pagerduty_incident_info",
+			Help:        "PagerDuty incident",
+			ConstLabels: m.constLabels(),
 		},
 		[]string{
 			"incidentID",
@@ -40,14 +87,33 @@ func (m *MetricsCollectorIncident) Setup(collector *collector.Collector) {
 			"assigned",
 			"type",
 			"time",
+			"priorityID",
+			"priorityName",
+			"priorityOrder",
+			"escalationPolicyID",
+			"escalationLevel",
 		},
 	)
-	m.Collector.RegisterMetricList("pagerduty_incident_info", m.prometheus.incident, true)
+	m.registerMetricList("pagerduty_incident_info", m.prometheus.incident, true)
+
+	m.prometheus.incidentTeam = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "pagerduty_incident_team",
+			Help:        "PagerDuty incident team",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{
+			"incidentID",
+			"teamID",
+		},
+	)
+	m.registerMetricList("pagerduty_incident_team", m.prometheus.incidentTeam, true)
 
 	m.prometheus.incidentStatus = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "pagerduty_incident_status",
-			Help: "PagerDuty incident status",
+			Name:        "pagerduty_incident_status",
+			Help:        "PagerDuty incident status",
+			ConstLabels: m.constLabels(),
 		},
 		[]string{
 			"incidentID",
@@ -56,89 +122,658 @@ func (m *MetricsCollectorIncident) Setup(collector *collector.Collector) {
 			"type",
 		},
 	)
-	m.Collector.RegisterMetricList("pagerduty_incident_status", m.prometheus.incidentStatus, true)
-}
+	m.registerMetricList("pagerduty_incident_status", m.prometheus.incidentStatus, true)
+
+	m.prometheus.incidentOpenCount = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "pagerduty_incident_open_count",
+			Help:        "PagerDuty count of open incidents",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{
+			"serviceID",
+			"teamID",
+			"status",
+			"urgency",
+			"priority",
+		},
+	)
+	m.registerMetricList("pagerduty_incident_open_count", m.prometheus.incidentOpenCount, true)
+
+	m.prometheus.incidentOpenOldestAge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "pagerduty_incident_open_oldest_age_seconds",
+			Help:        "PagerDuty age of the oldest open incident",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{
+			"serviceID",
+		},
+	)
+	m.registerMetricList("pagerduty_incident_open_oldest_age_seconds", m.prometheus.incidentOpenOldestAge, true)
+
+	m.prometheus.incidentUnacknowledgedCount = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "pagerduty_incident_unacknowledged_count",
+			Help:        "PagerDuty count of triggered (unacknowledged) incidents",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{
+			"serviceID",
+			"urgency",
+		},
+	)
+	m.registerMetricList("pagerduty_incident_unacknowledged_count", m.prometheus.incidentUnacknowledgedCount, true)
 
-func (m *MetricsCollectorIncident) Reset() {
+	m.prometheus.incidentListTruncated = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "pagerduty_incident_list_truncated",
+			Help:        "PagerDuty incident list was truncated by the incident limit (1 = truncated)",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{
+			"list",
+		},
+	)
+	m.registerMetricList("pagerduty_incident_list_truncated", m.prometheus.incidentListTruncated, true)
+
+	m.prometheus.incidentAlertCount = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "pagerduty_incident_alert_count",
+			Help:        "PagerDuty count of alerts of open incidents",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{
+			"incidentID",
+			"status",
+		},
+	)
+	m.registerMetricList("pagerduty_incident_alert_count", m.prometheus.incidentAlertCount, true)
+
+	m.prometheus.incidentAlert = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "pagerduty_incident_alert_info",
+			Help:        "PagerDuty alert of open incidents",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{
+			"incidentID",
+			"alertID",
+			"status",
+			"severity",
+			"sourceComponent",
+			"dedupKey",
+		},
+	)
+	m.registerMetricList("pagerduty_incident_alert_info", m.prometheus.incidentAlert, true)
 }
 
 func (m *MetricsCollectorIncident) Collect(callback chan<- func()) {
+	m.run(func() error {
+		return m.collectIncidents(callback)
+	})
+}
+
+func (m *MetricsCollectorIncident) collectIncidents(callback chan<- func()) error {
 	listOpts := pagerduty.ListIncidentsOptions{}
 	listOpts.Limit = PagerdutyListLimit
-	listOpts.Statuses = Opts.PagerDuty.Incident.Statuses
+	listOpts.Statuses = m.opts.PagerDuty.Incident.Statuses
 	listOpts.Offset = 0
 	listOpts.SortBy = "created_at:desc"
 
-	if len(m.teamListOpt) > 0 {
-		listOpts.TeamIDs = m.teamListOpt
+	if len(m.teamListOpt()) > 0 {
+		listOpts.TeamIDs = m.teamListOpt()
+	}
+
+	if err := m.updatePriorities(); err != nil {
+		return err
 	}
 
 	incidentMetricList := m.Collector.GetMetricList("pagerduty_incident_info")
+	incidentTeamMetricList := m.Collector.GetMetricList("pagerduty_incident_team")
 	incidentStatusMetricList := m.Collector.GetMetricList("pagerduty_incident_status")
+	incidentAlertCountMetricList := m.Collector.GetMetricList("pagerduty_incident_alert_count")
+	incidentListTruncatedMetricList := m.Collector.GetMetricList("pagerduty_incident_list_truncated")
 
+	// aggregates are based on all open incidents, the incident list is only reused if it contains the open incidents
+	aggregates := newIncidentAggregates()
+	openIncidentList := slices.Equal(sortedStrings(listOpts.Statuses), incidentOpenStatuses)
+
+	// open incidents with escalation level, levels of other incidents are removed after the run
+	openIncidents := map[string]bool{}
+	escalationLevelBudget := m.opts.PagerDuty.Incident.EscalationLevelLimit
+	truncated := false
 	for {
 		m.Logger().Debug("fetch incidents", slog.Uint64("offset", uint64(listOpts.Offset)), slog.Uint64("limit", uint64(listOpts.Limit)))
 
-		list, err := PagerDutyClient.ListIncidentsWithContext(m.Context(), listOpts)
-		PrometheusPagerDutyApiCounter.WithLabelValues("ListIncidents").Inc()
+		list, err := m.client().ListIncidentsWithContext(m.Context(), listOpts)
+		PrometheusPagerDutyApiCounter.WithLabelValues(m.account.Name, "ListIncidents").Inc()
+		if err != nil {
+			return m.handleError("ListIncidents", err)
+		}
+
+		for _, incident := range list.Incidents {
+			if m.opts.PagerDuty.Incident.EscalationLevel && incidentIsOpen(incident) {
+				openIncidents[incident.ID] = true
+				if err := m.updateEscalationLevel(incident, &escalationLevelBudget); err != nil {
+					return err
+				}
+			}
+
+			m.addIncident(m.opts, incidentMetricList.MetricList, incidentTeamMetricList.MetricList, incidentStatusMetricList.MetricList, incident)
+			if openIncidentList {
+				aggregates.add(incident)
+			}
+
+			if incidentIsOpen(incident) {
+				incidentAlertCountMetricList.Add(prometheus.Labels{"incidentID": incident.ID, "status": "triggered"}, float64(incident.AlertCounts.Triggered))
+				incidentAlertCountMetricList.Add(prometheus.Labels{"incidentID": incident.ID, "status": "resolved"}, float64(incident.AlertCounts.Resolved))
+
+				if m.opts.PagerDuty.Incident.AlertInfo {
+					if err := m.collectIncidentAlerts(incident); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		listOpts.Offset += PagerdutyListLimit
+		if stopPagerdutyPaging(list.APIListObject) || listOpts.Offset >= m.opts.PagerDuty.Incident.Limit {
+			truncated = list.More
+			break
+		}
+	}
+	incidentListTruncatedMetricList.AddBool(prometheus.Labels{"list": "incidents"}, truncated)
+	m.pruneEscalationLevels(openIncidents)
+
+	if !openIncidentList {
+		var err error
+		if truncated, err = m.collectOpenIncidents(aggregates); err != nil {
+			return err
+		}
+	}
+	incidentListTruncatedMetricList.AddBool(prometheus.Labels{"list": "open"}, truncated)
+
+	m.lookupLock.Lock()
+	m.openIncidents = aggregates
+	m.lookupLock.Unlock()
+
+	aggregates.apply(
+		m.Collector.GetMetricList("pagerduty_incident_open_count").MetricList,
+		m.Collector.GetMetricList("pagerduty_incident_open_oldest_age_seconds").MetricList,
+		m.Collector.GetMetricList("pagerduty_incident_unacknowledged_count").MetricList,
+	)
+
+	return nil
+}
+
+// collectOpenIncidents adds the open incidents (up to the incident limit) to the aggregates if they are not part of
+// the incident list (status filter), returns true if the list was truncated by the incident limit
+func (m *MetricsCollectorIncident) collectOpenIncidents(aggregates *incidentAggregates) (bool, error) {
+	listOpts := pagerduty.ListIncidentsOptions{}
+	listOpts.Limit = PagerdutyListLimit
+	listOpts.Statuses = incidentOpenStatuses
+	listOpts.Offset = 0
+	listOpts.SortBy = "created_at:desc"
+
+	if len(m.teamListOpt()) > 0 {
+		listOpts.TeamIDs = m.teamListOpt()
+	}
+
+	for {
+		m.Logger().Debug("fetch open incidents", slog.Uint64("offset", uint64(listOpts.Offset)), slog.Uint64("limit", uint64(listOpts.Limit)))
 
+		list, err := m.client().ListIncidentsWithContext(m.Context(), listOpts)
+		PrometheusPagerDutyApiCounter.WithLabelValues(m.account.Name, "ListIncidents").Inc()
 		if err != nil {
-			panic(err)
+			return false, m.handleError("ListIncidents", err)
 		}
 
 		for _, incident := range list.Incidents {
-			// info
-			createdAt, _ := time.Parse(time.RFC3339, incident.CreatedAt)
-
-			incidentMetricList.AddTime(prometheus.Labels{
-				"incidentID":     incident.ID,
-				"serviceID":      incident.Service.ID,
-				"incidentUrl":    incident.HTMLURL,
-				"incidentNumber": uintToString(incident.IncidentNumber),
-				"title":          incident.Title,
-				"status":         incident.Status,
-				"urgency":        incident.Urgency,
-				"acknowledged":   boolToString(len(incident.Acknowledgements) >= 1),
-				"assigned":       boolToString(len(incident.Assignments) >= 1),
-				"type":           incident.Type,
-				"time":           createdAt.Format(Opts.PagerDuty.Incident.TimeFormat),
+			aggregates.add(incident)
+		}
+
+		listOpts.Offset += PagerdutyListLimit
+		if stopPagerdutyPaging(list.APIListObject) || listOpts.Offset >= m.opts.PagerDuty.Incident.Limit {
+			return list.More, nil
+		}
+	}
+}
+
+// collectIncidentAlerts adds the (newest) alerts of the incident up to the alert info limit
+func (m *MetricsCollectorIncident) collectIncidentAlerts(incident pagerduty.Incident) error {
+	incidentAlertMetricList := m.Collector.GetMetricList("pagerduty_incident_alert_info")
+
+	listOpts := pagerduty.ListIncidentAlertsOptions{}
+	listOpts.Offset = 0
+	listOpts.SortBy = "created_at:desc"
+
+	for listOpts.Offset < m.opts.PagerDuty.Incident.AlertInfoLimit {
+		// last page only fetches the remaining alerts up to the limit
+		listOpts.Limit = min(PagerdutyListLimit, m.opts.PagerDuty.Incident.AlertInfoLimit-listOpts.Offset)
+
+		m.Logger().Debug("fetch incident alerts", slog.String("incident", incident.ID), slog.Uint64("offset", uint64(listOpts.Offset)), slog.Uint64("limit", uint64(listOpts.Limit)))
+
+		list, err := m.client().ListIncidentAlertsWithContext(m.Context(), incident.ID, listOpts)
+		PrometheusPagerDutyApiCounter.WithLabelValues(m.account.Name, "ListIncidentAlerts").Inc()
+		if err != nil {
+			// incident might have been resolved and merged in the meantime
+			if err := m.handleError("ListIncidentAlerts", err); isAbortError(err) {
+				return err
+			}
+			return nil
+		}
+
+		for _, alert := range list.Alerts {
+			createdAt, _ := time.Parse(time.RFC3339, alert.CreatedAt)
+			incidentAlertMetricList.AddTime(prometheus.Labels{
+				"incidentID":      incident.ID,
+				"alertID":         alert.ID,
+				"status":          alert.Status,
+				"severity":        alert.Severity,
+				"sourceComponent": alertSourceComponent(alert),
+				"dedupKey":        alert.AlertKey,
 			}, createdAt)
+		}
+
+		listOpts.Offset += listOpts.Limit
+		if stopPagerdutyPaging(list.APIListObject) {
+			break
+		}
+	}
 
-			// acknowledgement
-			for _, acknowledgement := range incident.Acknowledgements {
-				createdAt, _ := time.Parse(time.RFC3339, acknowledgement.At)
-				incidentStatusMetricList.AddTime(prometheus.Labels{
-					"incidentID": incident.ID,
-					"userID":     acknowledgement.Acknowledger.ID,
-					"time":       createdAt.Format(Opts.PagerDuty.Incident.TimeFormat),
-					"type":       "acknowledgement",
-				}, createdAt)
+	return nil
+}
+
+// alertSourceComponent returns the source component of the alert (from the common event format details)
+func alertSourceComponent(alert pagerduty.IncidentAlert) string {
+	if cefDetails, ok := alert.Body["cef_details"].(map[string]interface{}); ok {
+		if component, ok := cefDetails["source_component"].(string); ok {
+			return component
+		}
+	}
+	return ""
+}
+
+// sortedStrings returns a sorted copy of the values
+func sortedStrings(values []string) []string {
+	ret := slices.Clone(values)
+	slices.Sort(ret)
+	return ret
+}
+
+// incidentIsOpen returns true for triggered and acknowledged incidents
+func incidentIsOpen(incident pagerduty.Incident) bool {
+	return incident.Status == "triggered" || incident.Status == "acknowledged"
+}
+
+// updatePriorities fetches the priorities, the priorities are cached for the general scrape time
+func (m *MetricsCollectorIncident) updatePriorities() error {
+	m.lookupLock.RLock()
+	cached := m.priorityOrder != nil && time.Since(m.priorityOrderTime) < m.opts.ScrapeTime.General
+	m.lookupLock.RUnlock()
+	if cached {
+		return nil
+	}
+
+	priorityOrder := map[string]int{}
+
+	m.Logger().Debug("fetch priorities")
+
+	priorityListOpts := pagerduty.ListPrioritiesOptions{}
+	priorityListOpts.Limit = PagerdutyListLimit
+	for {
+		list, err := m.client().ListPrioritiesWithContext(m.Context(), priorityListOpts)
+		PrometheusPagerDutyApiCounter.WithLabelValues(m.account.Name, "ListPriorities").Inc()
+		if err != nil {
+			// priorities are not available for all plans
+			if err := m.handleError("ListPriorities", err); isAbortError(err) {
+				return err
 			}
+			break
+		}
+
+		// priorities are returned ordered from the highest to the lowest priority
+		for _, priority := range list.Priorities {
+			priorityOrder[priority.ID] = len(priorityOrder) + 1
+		}
+
+		priorityListOpts.Offset += PagerdutyListLimit
+		if stopPagerdutyPaging(list.APIListObject) {
+			break
+		}
+	}
+
+	m.lookupLock.Lock()
+	defer m.lookupLock.Unlock()
+	m.priorityOrder = priorityOrder
+	m.priorityOrderTime = time.Now()
+
+	return nil
+}
+
+// updateEscalationLevel fetches the escalation level of an open incident from its log entries, the level
+// is only fetched again if the assignees or the status of the incident have changed (escalations reassign
+// the incident). Each fetch consumes the budget of the run, without budget the previous level is kept.
+func (m *MetricsCollectorIncident) updateEscalationLevel(incident pagerduty.Incident, budget *uint) error {
+	key := incidentEscalationKey(incident)
+
+	m.lookupLock.RLock()
+	cached, exists := m.escalationLevels[incident.ID]
+	m.lookupLock.RUnlock()
+	if exists && cached.key == key {
+		return nil
+	}
+
+	if *budget == 0 {
+		m.Logger().Debug("escalation level limit reached, incident is updated in next run", slog.String("incident", incident.ID))
+		return nil
+	}
+	*budget--
+
+	level, err := m.fetchEscalationLevel(incident)
+	if err != nil {
+		// incidents are still exported, without escalation level
+		if isAbortError(err) {
+			return err
+		}
+		return nil
+	}
+
+	m.lookupLock.Lock()
+	defer m.lookupLock.Unlock()
+	m.escalationLevels[incident.ID] = incidentEscalationLevel{key: key, level: level}
+
+	return nil
+}
+
+// pruneEscalationLevels removes the escalation levels of incidents which are not open anymore
+func (m *MetricsCollectorIncident) pruneEscalationLevels(openIncidents map[string]bool) {
+	m.lookupLock.Lock()
+	defer m.lookupLock.Unlock()
 
-			// assignment
-			for _, assignment := range incident.Assignments {
-				createdAt, _ := time.Parse(time.RFC3339, assignment.At)
-				incidentStatusMetricList.AddTime(prometheus.Labels{
-					"incidentID": incident.ID,
-					"userID":     assignment.Assignee.ID,
-					"time":       createdAt.Format(Opts.PagerDuty.Incident.TimeFormat),
-					"type":       "assignment",
-				}, createdAt)
+	for incidentID := range m.escalationLevels {
+		if !openIncidents[incidentID] {
+			delete(m.escalationLevels, incidentID)
+		}
+	}
+}
+
+// fetchEscalationLevel returns the escalation level of the newest escalate log entry of the incident,
+// incidents which were not escalated are on the first level. The level is empty if the newest escalate
+// log entry contains no level.
+func (m *MetricsCollectorIncident) fetchEscalationLevel(incident pagerduty.Incident) (string, error) {
+	level := "1"
+	escalatedAt := time.Time{}
+
+	listOpts := pagerduty.ListIncidentLogEntriesOptions{
+		IsOverview: true,
+	}
+	listOpts.Limit = PagerdutyListLimit
+	listOpts.Offset = 0
+
+	for {
+		m.Logger().Debug("fetch incident log entries", slog.String("incident", incident.ID), slog.Uint64("offset", uint64(listOpts.Offset)), slog.Uint64("limit", uint64(listOpts.Limit)))
+
+		list, err := m.client().ListIncidentLogEntriesWithContext(m.Context(), incident.ID, listOpts)
+		PrometheusPagerDutyApiCounter.WithLabelValues(m.account.Name, "ListIncidentLogEntries").Inc()
+		if err != nil {
+			return "", m.handleError("ListIncidentLogEntries", err)
+		}
+
+		for _, entry := range list.LogEntries {
+			if entry.Type != "escalate_log_entry" {
+				continue
 			}
 
-			// lastChange
-			changedAt, _ := time.Parse(time.RFC3339, incident.LastStatusChangeAt)
-			incidentStatusMetricList.AddTime(prometheus.Labels{
-				"incidentID": incident.ID,
-				"userID":     incident.LastStatusChangeBy.ID,
-				"time":       changedAt.Format(Opts.PagerDuty.Incident.TimeFormat),
-				"type":       "lastChange",
-			}, changedAt)
+			createdAt, _ := time.Parse(time.RFC3339, entry.CreatedAt)
+			if !createdAt.Before(escalatedAt) {
+				level = escalateLogEntryLevel(entry)
+				escalatedAt = createdAt
+			}
 		}
 
 		listOpts.Offset += PagerdutyListLimit
-		if stopPagerdutyPaging(list.APIListObject) || listOpts.Offset >= Opts.PagerDuty.Incident.Limit {
+		if stopPagerdutyPaging(list.APIListObject) {
 			break
 		}
 	}
+
+	return level, nil
+}
+
+// escalateLogEntryLevel returns the escalation level of an escalate log entry (summary "Escalated to level 2 ..."),
+// empty if the summary contains no level
+func escalateLogEntryLevel(entry pagerduty.LogEntry) string {
+	if match := escalateLogEntryLevelRegexp.FindStringSubmatch(entry.Summary); match != nil {
+		return match[1]
+	}
+	return ""
+}
+
+// incidentEscalationKey returns the status, last status change and assignees of the incident
+func incidentEscalationKey(incident pagerduty.Incident) string {
+	assignees := make([]string, 0, len(incident.Assignments))
+	for _, assignment := range incident.Assignments {
+		assignees = append(assignees, assignment.Assignee.ID)
+	}
+	slices.Sort(assignees)
+
+	return incident.Status + "|" + incident.LastStatusChangeAt + "|" + strings.Join(assignees, ",")
+}
+
+// incidentPriorityLabels returns the priority ID, name and order of the incident (empty if the incident has no priority)
+func (m *MetricsCollectorIncident) incidentPriorityLabels(incident pagerduty.Incident) (string, string, string) {
+	if incident.Priority == nil || incident.Priority.ID == "" {
+		return "", "", ""
+	}
+
+	m.lookupLock.RLock()
+	defer m.lookupLock.RUnlock()
+
+	order := ""
+	if val, exists := m.priorityOrder[incident.Priority.ID]; exists {
+		order = strconv.Itoa(val)
+	}
+
+	return incident.Priority.ID, incident.Priority.Name, order
+}
+
+// incidentEscalationLevel returns the escalation level of the incident fetched by the last run (empty if unknown
+// or the incident is not open)
+func (m *MetricsCollectorIncident) incidentEscalationLevel(incident pagerduty.Incident) string {
+	if !incidentIsOpen(incident) {
+		return ""
+	}
+
+	m.lookupLock.RLock()
+	defer m.lookupLock.RUnlock()
+
+	return m.escalationLevels[incident.ID].level
+}
+
+// incidentTeamIDs returns the team IDs of the incident, incidents without team return an empty teamID
+// (incidents with multiple teams are counted once per team)
+func incidentTeamIDs(incident pagerduty.Incident) []string {
+	if len(incident.Teams) == 0 {
+		return []string{""}
+	}
+
+	teamIDs := make([]string, 0, len(incident.Teams))
+	for _, team := range incident.Teams {
+		teamIDs = append(teamIDs, team.ID)
+	}
+	return teamIDs
+}
+
+func newIncidentAggregates() *incidentAggregates {
+	return &incidentAggregates{
+		incidents: map[string]pagerduty.Incident{},
+	}
+}
+
+// add adds the incident if it's open (triggered or acknowledged)
+func (a *incidentAggregates) add(incident pagerduty.Incident) {
+	if !incidentIsOpen(incident) {
+		return
+	}
+
+	a.incidents[incident.ID] = pagerduty.Incident{
+		APIObject: pagerduty.APIObject{ID: incident.ID},
+		Service:   pagerduty.APIObject{ID: incident.Service.ID},
+		Teams:     incident.Teams,
+		Status:    incident.Status,
+		Urgency:   incident.Urgency,
+		Priority:  incident.Priority,
+		CreatedAt: incident.CreatedAt,
+	}
+}
+
+// apply adds the aggregates to the metric lists
+func (a *incidentAggregates) apply(openCountMetricList, openOldestAgeMetricList, unacknowledgedCountMetricList *prometheusCommon.MetricList) {
+	openCount := map[string]*prometheusCommon.MetricRow{}
+	openOldest := map[string]time.Time{}
+	unacknowledgedCount := map[string]*prometheusCommon.MetricRow{}
+
+	for _, incident := range a.incidents {
+		priority := ""
+		if incident.Priority != nil {
+			priority = incident.Priority.Name
+		}
+
+		for _, teamID := range incidentTeamIDs(incident) {
+			incrementMetricRow(openCount, prometheus.Labels{
+				"serviceID": incident.Service.ID,
+				"teamID":    teamID,
+				"status":    incident.Status,
+				"urgency":   incident.Urgency,
+				"priority":  priority,
+			})
+		}
+
+		if incident.Status == "triggered" {
+			incrementMetricRow(unacknowledgedCount, prometheus.Labels{
+				"serviceID": incident.Service.ID,
+				"urgency":   incident.Urgency,
+			})
+		}
+
+		if createdAt, err := time.Parse(time.RFC3339, incident.CreatedAt); err == nil {
+			if oldest, exists := openOldest[incident.Service.ID]; !exists || createdAt.Before(oldest) {
+				openOldest[incident.Service.ID] = createdAt
+			}
+		}
+	}
+
+	for _, row := range openCount {
+		openCountMetricList.Add(row.Labels, row.Value)
+	}
+
+	now := time.Now()
+	for serviceID, createdAt := range openOldest {
+		openOldestAgeMetricList.Add(prometheus.Labels{
+			"serviceID": serviceID,
+		}, now.Sub(createdAt).Seconds())
+	}
+
+	for _, row := range unacknowledgedCount {
+		unacknowledgedCountMetricList.Add(row.Labels, row.Value)
+	}
+}
+
+// updateOpenIncident updates the incident in the open incidents of the last run (used by the webhook receiver)
+// and returns the rebuilt aggregates, returns false if there was no run yet
+func (m *MetricsCollectorIncident) updateOpenIncident(opts *config.Opts, incident pagerduty.Incident) (openCountMetricList, openOldestAgeMetricList, unacknowledgedCountMetricList *prometheusCommon.MetricList, ok bool) {
+	m.lookupLock.Lock()
+	defer m.lookupLock.Unlock()
+
+	if m.openIncidents == nil {
+		return nil, nil, nil, false
+	}
+
+	existing, exists := m.openIncidents.incidents[incident.ID]
+	switch {
+	case !incidentIsOpen(incident):
+		delete(m.openIncidents.incidents, incident.ID)
+	case !exists && uint(len(m.openIncidents.incidents)) >= opts.PagerDuty.Incident.Limit:
+		// collector counts not more than the incident limit
+	default:
+		if incident.CreatedAt == "" {
+			incident.CreatedAt = existing.CreatedAt
+		}
+		m.openIncidents.add(incident)
+	}
+
+	openCountMetricList = prometheusCommon.NewMetricsList()
+	openOldestAgeMetricList = prometheusCommon.NewMetricsList()
+	unacknowledgedCountMetricList = prometheusCommon.NewMetricsList()
+	m.openIncidents.apply(openCountMetricList, openOldestAgeMetricList, unacknowledgedCountMetricList)
+
+	return openCountMetricList, openOldestAgeMetricList, unacknowledgedCountMetricList, true
+}
+
+// addIncident adds the info, team and status metrics of an incident to the metric lists (also used by the
+// webhook receiver, so the config is passed explicitly)
+func (m *MetricsCollectorIncident) addIncident(opts *config.Opts, incidentMetricList, incidentTeamMetricList, incidentStatusMetricList *prometheusCommon.MetricList, incident pagerduty.Incident) {
+	// info
+	createdAt, _ := time.Parse(time.RFC3339, incident.CreatedAt)
+	priorityID, priorityName, priorityOrder := m.incidentPriorityLabels(incident)
+
+	incidentMetricList.AddTime(prometheus.Labels{
+		"incidentID":         incident.ID,
+		"serviceID":          incident.Service.ID,
+		"incidentUrl":        incident.HTMLURL,
+		"incidentNumber":     uintToString(incident.IncidentNumber),
+		"title":              incident.Title,
+		"status":             incident.Status,
+		"urgency":            incident.Urgency,
+		"acknowledged":       boolToString(len(incident.Acknowledgements) >= 1),
+		"assigned":           boolToString(len(incident.Assignments) >= 1),
+		"type":               incident.Type,
+		"time":               createdAt.Format(opts.PagerDuty.Incident.TimeFormat),
+		"priorityID":         priorityID,
+		"priorityName":       priorityName,
+		"priorityOrder":      priorityOrder,
+		"escalationPolicyID": incident.EscalationPolicy.ID,
+		"escalationLevel":    m.incidentEscalationLevel(incident),
+	}, createdAt)
+
+	// teams
+	for _, team := range incident.Teams {
+		incidentTeamMetricList.AddInfo(prometheus.Labels{
+			"incidentID": incident.ID,
+			"teamID":     team.ID,
+		})
+	}
+
+	// acknowledgement
+	for _, acknowledgement := range incident.Acknowledgements {
+		createdAt, _ := time.Parse(time.RFC3339, acknowledgement.At)
+		incidentStatusMetricList.AddTime(prometheus.Labels{
+			"incidentID": incident.ID,
+			"userID":     acknowledgement.Acknowledger.ID,
+			"time":       createdAt.Format(opts.PagerDuty.Incident.TimeFormat),
+			"type":       "acknowledgement",
+		}, createdAt)
+	}
+
+	// assignment
+	for _, assignment := range incident.Assignments {
+		createdAt, _ := time.Parse(time.RFC3339, assignment.At)
+		incidentStatusMetricList.AddTime(prometheus.Labels{
+			"incidentID": incident.ID,
+			"userID":     assignment.Assignee.ID,
+			"time":       createdAt.Format(opts.PagerDuty.Incident.TimeFormat),
+			"type":       "assignment",
+		}, createdAt)
+	}
+
+	// lastChange
+	changedAt, _ := time.Parse(time.RFC3339, incident.LastStatusChangeAt)
+	incidentStatusMetricList.AddTime(prometheus.Labels{
+		"incidentID": incident.ID,
+		"userID":     incident.LastStatusChangeBy.ID,
+		"time":       changedAt.Format(opts.PagerDuty.Incident.TimeFormat),
+		"type":       "lastChange",
+	}, changedAt)
 }
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PagerDuty/go-pagerduty"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/webdevops/go-common/prometheus/collector"
+)
+
+const (
+	// overlap of log entry stream fetches, log entries may show up delayed
+	logStreamOverlap = 5 * time.Minute
+
+	// smallest window which is split if the log entries of the window exceed the paging limit
+	logStreamMinWindow = time.Minute
+
+	// version of the persisted stream state, needs to be increased if the format or the meaning of the state changes
+	logStreamStateVersion = "logstream.v1"
+)
+
+type (
+	MetricsCollectorLogStream struct {
+		PagerDutyProcessor
+
+		prometheus struct {
+			notifications     *prometheus.CounterVec
+			userNotifications *prometheus.CounterVec
+			escalations       *prometheus.CounterVec
+			acknowledgements  *prometheus.CounterVec
+			autoResolves      *prometheus.CounterVec
+			cursor            *prometheus.GaugeVec
+		}
+
+		state     *logStreamState
+		stateFile *stateFile
+		stateTag  string
+	}
+
+	logStreamState struct {
+		Tag    string     `json:"tag"`
+		Cursor *time.Time `json:"cursor"`
+		// log entries of the overlap window which were already counted
+		Seen map[string]time.Time `json:"seen"`
+		// counter values, restored after restarts so counters are monotonic
+		Counters map[string]*logStreamCounter `json:"counters"`
+	}
+
+	logStreamCounter struct {
+		Metric string            `json:"metric"`
+		Labels prometheus.Labels `json:"labels"`
+		Value  float64           `json:"value"`
+	}
+
+	// logStreamEntry is a log entry with the notification details (not supported by go-pagerduty)
+	logStreamEntry struct {
+		ID        string              `json:"id"`
+		Type      string              `json:"type"`
+		CreatedAt string              `json:"created_at"`
+		Agent     pagerduty.APIObject `json:"agent"`
+		Channel   struct {
+			Type string `json:"type"`
+		} `json:"channel"`
+		User     pagerduty.APIObject `json:"user"`
+		Service  pagerduty.APIObject `json:"service"`
+		Incident struct {
+			pagerduty.APIObject
+			EscalationPolicy pagerduty.APIObject `json:"escalation_policy"`
+		} `json:"incident"`
+		Notification *struct {
+			Type string `json:"type"`
+		} `json:"notification"`
+	}
+
+	logStreamEntryList struct {
+		pagerduty.APIListObject
+		LogEntries []logStreamEntry `json:"log_entries"`
+	}
+)
+
+func (m *MetricsCollectorLogStream) Setup(collector *collector.Collector) {
+	m.Processor.Setup(collector)
+
+	m.prometheus.notifications = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:        "pagerduty_logstream_notifications_total",
+			Help:        "PagerDuty notifications sent to users by channel (sms, phone, push, email)",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{
+			"userID",
+			"channel",
+		},
+	)
+	mustRegisterMetricFamily("pagerduty_logstream_notifications_total", m.prometheus.notifications)
+
+	m.prometheus.userNotifications = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:        "pagerduty_user_notifications_total",
+			Help:        "PagerDuty notifications sent to users by channel and period (business_hours, evening, sleep or weekend in the time zone of the user)",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{
+			"userID",
+			"channel",
+			"period",
+		},
+	)
+	mustRegisterMetricFamily("pagerduty_user_notifications_total", m.prometheus.userNotifications)
+
+	m.prometheus.escalations = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:        "pagerduty_logstream_escalations_total",
+			Help:        "PagerDuty incident escalations by escalation policy",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{
+			"escalationPolicyID",
+		},
+	)
+	mustRegisterMetricFamily("pagerduty_logstream_escalations_total", m.prometheus.escalations)
+
+	m.prometheus.acknowledgements = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:        "pagerduty_logstream_acknowledgements_total",
+			Help:        "PagerDuty incident acknowledgements by user",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{
+			"userID",
+		},
+	)
+	mustRegisterMetricFamily("pagerduty_logstream_acknowledgements_total", m.prometheus.acknowledgements)
+
+	m.prometheus.autoResolves = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name:        "pagerduty_logstream_auto_resolves_total",
+			Help:        "PagerDuty incidents which were not resolved by an user (eg. auto resolve timeout or integration) by service and channel",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{
+			"serviceID",
+			"channel",
+		},
+	)
+	mustRegisterMetricFamily("pagerduty_logstream_auto_resolves_total", m.prometheus.autoResolves)
+
+	m.prometheus.cursor = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "pagerduty_logstream_cursor_timestamp_seconds",
+			Help:        "PagerDuty log entry stream position (all log entries until this time are counted)",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{},
+	)
+	mustRegisterMetricFamily("pagerduty_logstream_cursor_timestamp_seconds", m.prometheus.cursor)
+}
+
+func (m *MetricsCollectorLogStream) Collect(callback chan<- func()) {
+	m.run(func() error {
+		return m.collectLogEntries(callback)
+	})
+}
+
+func (m *MetricsCollectorLogStream) collectLogEntries(callback chan<- func()) error {
+	now := time.Now().UTC()
+
+	if m.state == nil {
+		m.loadState()
+	}
+
+	if m.state.Cursor == nil {
+		// counting starts now, older log entries are not counted
+		m.state.Cursor = &now
+	} else {
+		since := m.state.Cursor.Add(-logStreamOverlap)
+
+		entries, err := m.fetchLogEntries(since, now)
+		if err != nil {
+			// cursor is not moved, log entries will be fetched again in next run
+			return err
+		}
+
+		for _, entry := range entries {
+			m.applyLogEntry(entry)
+		}
+
+		// only log entries of the overlap window are needed for deduplication
+		for id, createdAt := range m.state.Seen {
+			if createdAt.Before(now.Add(-logStreamOverlap)) {
+				delete(m.state.Seen, id)
+			}
+		}
+
+		m.state.Cursor = &now
+	}
+
+	if err := m.stateFile.Save(m.state); err != nil {
+		m.Logger().Warn("unable to save state", slog.Any("error", err))
+	}
+
+	if !metricFamilyDisabled(m.opts, "pagerduty_logstream_cursor_timestamp_seconds") {
+		m.prometheus.cursor.WithLabelValues().Set(float64(m.state.Cursor.Unix()))
+	}
+
+	return nil
+}
+
+// loadState restores the cursor and counters from the state file (if tag matches) or starts with an empty state
+func (m *MetricsCollectorLogStream) loadState() {
+	state := &logStreamState{}
+	if m.stateFile.Load(state) && state.Tag == m.stateTag && state.Cursor != nil {
+		m.Logger().Info("restored log entry stream state", slog.Int("counters", len(state.Counters)), slog.Time("cursor", *state.Cursor))
+		if state.Seen == nil {
+			state.Seen = map[string]time.Time{}
+		}
+		if state.Counters == nil {
+			state.Counters = map[string]*logStreamCounter{}
+		}
+		m.state = state
+
+		counters := m.state.Counters
+		m.state.Counters = map[string]*logStreamCounter{}
+		for key, counter := range counters {
+			vec := m.counterVec(counter.Metric)
+			if vec == nil || logStreamCounterKey(counter.Metric, counter.Labels) != key {
+				continue
+			}
+
+			// counters of disabled metrics or exceeding the series limit are not restored,
+			// counters are merged if labels are dropped or truncated since the last start
+			labels, admitted := m.admitCounterSeries(counter.Metric, counter.Labels)
+			if !admitted {
+				continue
+			}
+			counter.Labels = labels
+			key = logStreamCounterKey(counter.Metric, counter.Labels)
+			if existing, exists := m.state.Counters[key]; exists {
+				existing.Value += counter.Value
+			} else {
+				m.state.Counters[key] = counter
+			}
+			vec.With(counter.Labels).Add(counter.Value)
+		}
+		return
+	}
+
+	m.state = &logStreamState{
+		Tag:      m.stateTag,
+		Seen:     map[string]time.Time{},
+		Counters: map[string]*logStreamCounter{},
+	}
+}
+
+// fetchLogEntries fetches all log entries between since and until, windows exceeding the paging limit are split
+func (m *MetricsCollectorLogStream) fetchLogEntries(since, until time.Time) ([]logStreamEntry, error) {
+	query := url.Values{}
+	query.Add("include[]", "incidents")
+	query.Set("since", since.Format(time.RFC3339))
+	query.Set("until", until.Format(time.RFC3339))
+	query.Set("limit", strconv.Itoa(PagerdutyListLimit))
+	for _, teamID := range m.teamListOpt() {
+		query.Add("team_ids[]", teamID)
+	}
+
+	ret := []logStreamEntry{}
+	offset := uint(0)
+	for {
+		query.Set("offset", strconv.FormatUint(uint64(offset), 10))
+
+		m.Logger().Debug("fetch log entries", slog.Uint64("offset", uint64(offset)), slog.Uint64("limit", uint64(PagerdutyListLimit)), slog.String("since", query.Get("since")), slog.String("until", query.Get("until")))
+
+		list := logStreamEntryList{}
+		PrometheusPagerDutyApiCounter.WithLabelValues(m.account.Name, "ListLogEntries").Inc()
+		if err := m.account.apiGet(m.Context(), "/log_entries", query, nil, &list); err != nil {
+			return nil, m.handleError("ListLogEntries", err)
+		}
+		ret = append(ret, list.LogEntries...)
+
+		if list.More && offset+PagerdutyListLimit >= PAGERDUTY_MAX_PAGING_LIMIT {
+			window := until.Sub(since)
+			if window <= logStreamMinWindow {
+				m.Logger().Warn("too many log entries in log entry stream window, log entries are skipped", slog.Time("since", since), slog.Time("until", until))
+				return ret, nil
+			}
+
+			// too many log entries for paging, fetch both halves of the window separately
+			middle := since.Add(window / 2)
+			first, err := m.fetchLogEntries(since, middle)
+			if err != nil {
+				return nil, err
+			}
+			second, err := m.fetchLogEntries(middle, until)
+			if err != nil {
+				return nil, err
+			}
+			return append(first, second...), nil
+		}
+
+		offset += PagerdutyListLimit
+		if !list.More || len(list.LogEntries) == 0 {
+			break
+		}
+	}
+
+	return ret, nil
+}
+
+// applyLogEntry increments the counters of the log entry (if not already counted)
+func (m *MetricsCollectorLogStream) applyLogEntry(entry logStreamEntry) {
+	if _, seen := m.state.Seen[entry.ID]; seen || entry.ID == "" {
+		return
+	}
+	createdAt, err := time.Parse(time.RFC3339, entry.CreatedAt)
+	if err != nil {
+		return
+	}
+	m.state.Seen[entry.ID] = createdAt
+
+	switch strings.TrimSuffix(entry.Type, "_log_entry") {
+	case "notify":
+		if entry.Notification != nil && entry.User.ID != "" {
+			channel := strings.TrimSuffix(entry.Notification.Type, "_notification")
+			m.incrementCounter("pagerduty_logstream_notifications_total", prometheus.Labels{
+				"userID":  entry.User.ID,
+				"channel": channel,
+			})
+			m.incrementCounter("pagerduty_user_notifications_total", prometheus.Labels{
+				"userID":  entry.User.ID,
+				"channel": channel,
+				"period":  notificationPeriod(m.opts, createdAt, m.account.userTimeZone(entry.User.ID)),
+			})
+		}
+	case "escalate":
+		m.incrementCounter("pagerduty_logstream_escalations_total", prometheus.Labels{
+			"escalationPolicyID": entry.Incident.EscalationPolicy.ID,
+		})
+	case "acknowledge":
+		if strings.HasPrefix(entry.Agent.Type, "user") {
+			m.incrementCounter("pagerduty_logstream_acknowledgements_total", prometheus.Labels{
+				"userID": entry.Agent.ID,
+			})
+		}
+	case "resolve":
+		if !strings.HasPrefix(entry.Agent.Type, "user") {
+			m.incrementCounter("pagerduty_logstream_auto_resolves_total", prometheus.Labels{
+				"serviceID": entry.Service.ID,
+				"channel":   entry.Channel.Type,
+			})
+		}
+	}
+}
+
+// incrementCounter increments the counter and the persisted counter value, the guardrails of the metric
+// family are applied to the labels
+func (m *MetricsCollectorLogStream) incrementCounter(metric string, labels prometheus.Labels) {
+	labels, admitted := m.admitCounterSeries(metric, labels)
+	if !admitted {
+		return
+	}
+
+	key := logStreamCounterKey(metric, labels)
+	counter, exists := m.state.Counters[key]
+	if !exists {
+		counter = &logStreamCounter{Metric: metric, Labels: labels}
+		m.state.Counters[key] = counter
+	}
+	counter.Value++
+
+	m.counterVec(metric).With(labels).Inc()
+}
+
+// logStreamCounterKey returns the key of the persisted counter value (eg. metric{label="value"})
+func logStreamCounterKey(metric string, labels prometheus.Labels) string {
+	return metric + "{" + strings.ReplaceAll(metricSeriesKey(labels), "\xff", ",") + "}"
+}
+
+func (m *MetricsCollectorLogStream) counterVec(metric string) *prometheus.CounterVec {
+	switch metric {
+	case "pagerduty_logstream_notifications_total":
+		return m.prometheus.notifications
+	case "pagerduty_user_notifications_total":
+		return m.prometheus.userNotifications
+	case "pagerduty_logstream_escalations_total":
+		return m.prometheus.escalations
+	case "pagerduty_logstream_acknowledgements_total":
+		return m.prometheus.acknowledgements
+	case "pagerduty_logstream_auto_resolves_total":
+		return m.prometheus.autoResolves
+	default:
+		return nil
+	}
+}
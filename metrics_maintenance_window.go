@@ -10,14 +10,12 @@ import (
 )
 
 type MetricsCollectorMaintenanceWindow struct {
-	collector.Processor
+	PagerDutyProcessor
 
 	prometheus struct {
 		maintenanceWindow       *prometheus.GaugeVec
 		maintenanceWindowStatus *prometheus.GaugeVec
 	}
-
-	teamListOpt []string
 }
 
 func (m *MetricsCollectorMaintenanceWindow) Setup(collector *collector.Collector) {
@@ -25,20 +23,22 @@ func (m *MetricsCollectorMaintenanceWindow) Setup(collector *collector.Collector
 
 	m.prometheus.maintenanceWindow = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "pagerduty_maintenancewindow_info",
-			Help: "PagerDuty MaintenanceWindow",
+			Name:        "pagerduty_maintenancewindow_info",
+			Help:        "PagerDuty MaintenanceWindow",
+			ConstLabels: m.constLabels(),
 		},
 		[]string{
 			"windowID",
 			"serviceID",
 		},
 	)
-	m.Collector.RegisterMetricList("pagerduty_maintenancewindow_info", m.prometheus.maintenanceWindow, true)
+	m.registerMetricList("pagerduty_maintenancewindow_info", m.prometheus.maintenanceWindow, true)
 
 	m.prometheus.maintenanceWindowStatus = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "pagerduty_maintenancewindow_status",
-			Help: "PagerDuty MaintenanceWindow",
+			Name:        "pagerduty_maintenancewindow_status",
+			Help:        "PagerDuty MaintenanceWindow",
+			ConstLabels: m.constLabels(),
 		},
 		[]string{
 			"windowID",
@@ -46,19 +46,22 @@ func (m *MetricsCollectorMaintenanceWindow) Setup(collector *collector.Collector
 			"type",
 		},
 	)
-	m.Collector.RegisterMetricList("pagerduty_maintenancewindow_status", m.prometheus.maintenanceWindowStatus, true)
+	m.registerMetricList("pagerduty_maintenancewindow_status", m.prometheus.maintenanceWindowStatus, true)
 }
 
-func (m *MetricsCollectorMaintenanceWindow) Reset() {
+func (m *MetricsCollectorMaintenanceWindow) Collect(callback chan<- func()) {
+	m.run(func() error {
+		return m.collectMaintenanceWindows(callback)
+	})
 }
 
-func (m *MetricsCollectorMaintenanceWindow) Collect(callback chan<- func()) {
+func (m *MetricsCollectorMaintenanceWindow) collectMaintenanceWindows(callback chan<- func()) error {
 	listOpts := pagerduty.ListMaintenanceWindowsOptions{}
 	listOpts.Limit = PagerdutyListLimit
 	listOpts.Offset = 0
 
-	if len(m.teamListOpt) > 0 {
-		listOpts.TeamIDs = m.teamListOpt
+	if len(m.teamListOpt()) > 0 {
+		listOpts.TeamIDs = m.teamListOpt()
 	}
 
 	maintWindowMetricList := m.Collector.GetMetricList("pagerduty_maintenancewindow_info")
@@ -67,11 +70,10 @@ func (m *MetricsCollectorMaintenanceWindow) Collect(callback chan<- func()) {
 	for {
 		m.Logger().Debug("fetch maintenance windows", slog.Uint64("offset", uint64(listOpts.Offset)), slog.Uint64("limit", uint64(listOpts.Limit)))
 
-		list, err := PagerDutyClient.ListMaintenanceWindowsWithContext(m.Context(), listOpts)
-		PrometheusPagerDutyApiCounter.WithLabelValues("ListMaintenanceWindows").Inc()
-
+		list, err := m.client().ListMaintenanceWindowsWithContext(m.Context(), listOpts)
+		PrometheusPagerDutyApiCounter.WithLabelValues(m.account.Name, "ListMaintenanceWindows").Inc()
 		if err != nil {
-			panic(err)
+			return m.handleError("ListMaintenanceWindows", err)
 		}
 
 		currentTime := time.Now()
@@ -109,4 +111,6 @@ func (m *MetricsCollectorMaintenanceWindow) Collect(callback chan<- func()) {
 			break
 		}
 	}
+
+	return nil
 }
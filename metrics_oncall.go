@@ -10,7 +10,7 @@ import (
 )
 
 type MetricsCollectorOncall struct {
-	collector.Processor
+	PagerDutyProcessor
 
 	prometheus struct {
 		scheduleOnCall *prometheus.GaugeVec
@@ -22,18 +22,22 @@ func (m *MetricsCollectorOncall) Setup(collector *collector.Collector) {
 
 	m.prometheus.scheduleOnCall = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "pagerduty_schedule_oncall",
-			Help: "PagerDuty schedule oncall",
+			Name:        "pagerduty_schedule_oncall",
+			Help:        "PagerDuty schedule oncall",
+			ConstLabels: m.constLabels(),
 		},
 		[]string{"scheduleID", "userID", "escalationLevel", "type"},
 	)
-	m.Collector.RegisterMetricList("pagerduty_schedule_oncall", m.prometheus.scheduleOnCall, true)
+	m.registerMetricList("pagerduty_schedule_oncall", m.prometheus.scheduleOnCall, true)
 }
 
-func (m *MetricsCollectorOncall) Reset() {
+func (m *MetricsCollectorOncall) Collect(callback chan<- func()) {
+	m.run(func() error {
+		return m.collectOnCalls(callback)
+	})
 }
 
-func (m *MetricsCollectorOncall) Collect(callback chan<- func()) {
+func (m *MetricsCollectorOncall) collectOnCalls(callback chan<- func()) error {
 	listOpts := pagerduty.ListOnCallOptions{}
 	listOpts.Limit = PagerdutyListLimit
 	listOpts.Earliest = true
@@ -44,11 +48,10 @@ func (m *MetricsCollectorOncall) Collect(callback chan<- func()) {
 	for {
 		m.Logger().Debug("fetch schedule oncalls", slog.Uint64("offset", uint64(listOpts.Offset)), slog.Uint64("limit", uint64(listOpts.Limit)))
 
-		list, err := PagerDutyClient.ListOnCallsWithContext(m.Context(), listOpts)
-		PrometheusPagerDutyApiCounter.WithLabelValues("ListOnCalls").Inc()
-
+		list, err := m.client().ListOnCallsWithContext(m.Context(), listOpts)
+		PrometheusPagerDutyApiCounter.WithLabelValues(m.account.Name, "ListOnCalls").Inc()
 		if err != nil {
-			panic(err)
+			return m.handleError("ListOnCalls", err)
 		}
 
 		for _, oncall := range list.OnCalls {
@@ -89,4 +92,6 @@ func (m *MetricsCollectorOncall) Collect(callback chan<- func()) {
 			break
 		}
 	}
+
+	return nil
 }
@@ -10,7 +10,7 @@ import (
 )
 
 type MetricsCollectorSchedule struct {
-	collector.Processor
+	PagerDutyProcessor
 
 	prometheus struct {
 		schedule              *prometheus.GaugeVec
@@ -21,6 +21,11 @@ type MetricsCollectorSchedule struct {
 		scheduleFinalCoverage *prometheus.GaugeVec
 		scheduleOnCall        *prometheus.GaugeVec
 		scheduleOverwrite     *prometheus.GaugeVec
+		scheduleUserOnCall    *prometheus.GaugeVec
+		scheduleGapStart      *prometheus.GaugeVec
+		scheduleGapDuration   *prometheus.GaugeVec
+		scheduleNextGap       *prometheus.GaugeVec
+		scheduleUncovered     *prometheus.GaugeVec
 	}
 }
 
@@ -29,72 +34,132 @@ func (m *MetricsCollectorSchedule) Setup(collector *collector.Collector) {
 
 	m.prometheus.schedule = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "pagerduty_schedule_info",
-			Help: "PagerDuty schedule",
+			Name:        "pagerduty_schedule_info",
+			Help:        "PagerDuty schedule",
+			ConstLabels: m.constLabels(),
 		},
 		[]string{"scheduleID", "scheduleName", "scheduleTimeZone"},
 	)
-	m.Collector.RegisterMetricList("pagerduty_schedule_info", m.prometheus.schedule, true)
+	m.registerMetricList("pagerduty_schedule_info", m.prometheus.schedule, true)
 
 	m.prometheus.scheduleLayer = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "pagerduty_schedule_layer_info",
-			Help: "PagerDuty schedule layer information",
+			Name:        "pagerduty_schedule_layer_info",
+			Help:        "PagerDuty schedule layer information",
+			ConstLabels: m.constLabels(),
 		},
 		[]string{"scheduleID", "scheduleLayerID", "scheduleLayerName"},
 	)
-	m.Collector.RegisterMetricList("pagerduty_schedule_layer_info", m.prometheus.scheduleLayer, true)
+	m.registerMetricList("pagerduty_schedule_layer_info", m.prometheus.scheduleLayer, true)
 
 	m.prometheus.scheduleLayerEntry = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "pagerduty_schedule_layer_entry",
-			Help: "PagerDuty schedule layer entries",
+			Name:        "pagerduty_schedule_layer_entry",
+			Help:        "PagerDuty schedule layer entries",
+			ConstLabels: m.constLabels(),
 		},
 		[]string{"scheduleLayerID", "scheduleID", "userID", "time", "type"},
 	)
-	m.Collector.RegisterMetricList("pagerduty_schedule_layer_entry", m.prometheus.scheduleLayerEntry, true)
+	m.registerMetricList("pagerduty_schedule_layer_entry", m.prometheus.scheduleLayerEntry, true)
 
 	m.prometheus.scheduleLayerCoverage = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "pagerduty_schedule_layer_coverage",
-			Help: "PagerDuty schedule layer entry coverage",
+			Name:        "pagerduty_schedule_layer_coverage",
+			Help:        "PagerDuty schedule layer entry coverage",
+			ConstLabels: m.constLabels(),
 		},
 		[]string{"scheduleLayerID", "scheduleID"},
 	)
-	m.Collector.RegisterMetricList("pagerduty_schedule_layer_coverage", m.prometheus.scheduleLayerCoverage, true)
+	m.registerMetricList("pagerduty_schedule_layer_coverage", m.prometheus.scheduleLayerCoverage, true)
 
 	m.prometheus.scheduleFinalEntry = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "pagerduty_schedule_final_entry",
-			Help: "PagerDuty schedule final entries",
+			Name:        "pagerduty_schedule_final_entry",
+			Help:        "PagerDuty schedule final entries",
+			ConstLabels: m.constLabels(),
 		},
 		[]string{"scheduleID", "userID", "time", "type"},
 	)
-	m.Collector.RegisterMetricList("pagerduty_schedule_final_entry", m.prometheus.scheduleFinalEntry, true)
+	m.registerMetricList("pagerduty_schedule_final_entry", m.prometheus.scheduleFinalEntry, true)
 
 	m.prometheus.scheduleFinalCoverage = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "pagerduty_schedule_final_coverage",
-			Help: "PagerDuty schedule final entry coverage",
+			Name:        "pagerduty_schedule_final_coverage",
+			Help:        "PagerDuty schedule final entry coverage",
+			ConstLabels: m.constLabels(),
 		},
 		[]string{"scheduleID"},
 	)
-	m.Collector.RegisterMetricList("pagerduty_schedule_final_coverage", m.prometheus.scheduleFinalCoverage, true)
+	m.registerMetricList("pagerduty_schedule_final_coverage", m.prometheus.scheduleFinalCoverage, true)
 
 	m.prometheus.scheduleOverwrite = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "pagerduty_schedule_override",
-			Help: "PagerDuty schedule override",
+			Name:        "pagerduty_schedule_override",
+			Help:        "PagerDuty schedule override",
+			ConstLabels: m.constLabels(),
 		},
 		[]string{"overrideID", "scheduleID", "userID", "type"},
 	)
-	m.Collector.RegisterMetricList("pagerduty_schedule_override", m.prometheus.scheduleOverwrite, true)
-}
+	m.registerMetricList("pagerduty_schedule_override", m.prometheus.scheduleOverwrite, true)
+
+	m.prometheus.scheduleUserOnCall = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "pagerduty_schedule_user_oncall_seconds",
+			Help:        "PagerDuty oncall time of the user in the final schedule (by timeframe, day type and business or off hours)",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{"scheduleID", "userID", "timeframe", "dayType", "hours"},
+	)
+	m.registerMetricList("pagerduty_schedule_user_oncall_seconds", m.prometheus.scheduleUserOnCall, true)
 
-func (m *MetricsCollectorSchedule) Reset() {
+	m.prometheus.scheduleGapStart = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "pagerduty_schedule_gap_start_timestamp_seconds",
+			Help:        "PagerDuty schedule gap (nobody oncall in the final schedule) start time (start of the current gap is clipped to the gap timeframe)",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{"scheduleID", "time"},
+	)
+	m.registerMetricList("pagerduty_schedule_gap_start_timestamp_seconds", m.prometheus.scheduleGapStart, true)
+
+	m.prometheus.scheduleGapDuration = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "pagerduty_schedule_gap_duration_seconds",
+			Help:        "PagerDuty schedule gap (nobody oncall in the final schedule) duration",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{"scheduleID", "time"},
+	)
+	m.registerMetricList("pagerduty_schedule_gap_duration_seconds", m.prometheus.scheduleGapDuration, true)
+
+	m.prometheus.scheduleNextGap = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "pagerduty_schedule_next_gap_seconds",
+			Help:        "PagerDuty time until the next schedule gap starts (0 = currently nobody oncall)",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{"scheduleID"},
+	)
+	m.registerMetricList("pagerduty_schedule_next_gap_seconds", m.prometheus.scheduleNextGap, true)
+
+	m.prometheus.scheduleUncovered = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "pagerduty_schedule_uncovered_seconds",
+			Help:        "PagerDuty total time without oncall in the final schedule from now until the end of the gap timeframe",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{"scheduleID"},
+	)
+	m.registerMetricList("pagerduty_schedule_uncovered_seconds", m.prometheus.scheduleUncovered, true)
 }
 
 func (m *MetricsCollectorSchedule) Collect(callback chan<- func()) {
+	m.run(func() error {
+		return m.collectSchedules(callback)
+	})
+}
+
+func (m *MetricsCollectorSchedule) collectSchedules(callback chan<- func()) error {
 	listOpts := pagerduty.ListSchedulesOptions{}
 	listOpts.Limit = PagerdutyListLimit
 	listOpts.Offset = 0
@@ -104,11 +169,10 @@ func (m *MetricsCollectorSchedule) Collect(callback chan<- func()) {
 	for {
 		m.Logger().Debug("fetch schedules", slog.Uint64("offset", uint64(listOpts.Offset)), slog.Uint64("limit", uint64(listOpts.Limit)))
 
-		list, err := PagerDutyClient.ListSchedulesWithContext(m.Context(), listOpts)
-		PrometheusPagerDutyApiCounter.WithLabelValues("ListSchedules").Inc()
-
+		list, err := m.client().ListSchedulesWithContext(m.Context(), listOpts)
+		PrometheusPagerDutyApiCounter.WithLabelValues(m.account.Name, "ListSchedules").Inc()
 		if err != nil {
-			panic(err)
+			return m.handleError("ListSchedules", err)
 		}
 
 		for _, schedule := range list.Schedules {
@@ -118,9 +182,13 @@ func (m *MetricsCollectorSchedule) Collect(callback chan<- func()) {
 				"scheduleTimeZone": schedule.TimeZone,
 			})
 
-			// get detail information about schedule
-			m.collectScheduleInformation(schedule.ID, callback)
-			m.collectScheduleOverrides(schedule.ID, callback)
+			// get detail information about schedule, failed schedules are skipped
+			if err := m.collectScheduleInformation(schedule.ID, callback); isAbortError(err) {
+				return err
+			}
+			if err := m.collectScheduleOverrides(schedule.ID, callback); isAbortError(err) {
+				return err
+			}
 		}
 
 		listOpts.Offset += list.Limit
@@ -128,23 +196,53 @@ func (m *MetricsCollectorSchedule) Collect(callback chan<- func()) {
 			break
 		}
 	}
+
+	return nil
 }
 
-func (m *MetricsCollectorSchedule) collectScheduleInformation(scheduleID string, callback chan<- func()) {
-	filterSince := time.Now().Add(-Opts.ScrapeTime.General)
-	filterUntil := time.Now().Add(Opts.PagerDuty.Schedule.EntryTimeframe)
+func (m *MetricsCollectorSchedule) collectScheduleInformation(scheduleID string, callback chan<- func()) error {
+	now := time.Now()
+	filterSince := now.Add(-m.opts.ScrapeTime.General)
+	filterUntil := now.Add(m.opts.PagerDuty.Schedule.EntryTimeframe)
+
+	gapTimeframe := m.opts.PagerDuty.Schedule.GapLookAhead
+	if gapTimeframe <= 0 {
+		gapTimeframe = m.opts.PagerDuty.Schedule.EntryTimeframe
+	}
+	gapSince := now.Add(-gapTimeframe)
+	gapUntil := now.Add(gapTimeframe)
+
+	// schedule is fetched once for the entries, the gaps and the oncall time accounting, entries outside of the
+	// entry timeframe are not exported
+	onCallAccounting := m.opts.PagerDuty.Schedule.OnCallLookBack > 0 || m.opts.PagerDuty.Schedule.OnCallLookAhead > 0
+	fetchSince, fetchUntil := filterSince, filterUntil
+	timeframes := [][2]time.Time{{gapSince, gapUntil}}
+	if onCallAccounting {
+		timeframes = append(timeframes, [2]time.Time{now.Add(-m.opts.PagerDuty.Schedule.OnCallLookBack), now.Add(m.opts.PagerDuty.Schedule.OnCallLookAhead)})
+	}
+	for _, timeframe := range timeframes {
+		if timeframe[0].Before(fetchSince) {
+			fetchSince = timeframe[0]
+		}
+		if timeframe[1].After(fetchUntil) {
+			fetchUntil = timeframe[1]
+		}
+	}
+
+	// PagerDuty renders the coverage for the fetched timeframe, it's calculated for the entry timeframe
+	// if the fetched timeframe is wider
+	fetchWidened := !fetchSince.Equal(filterSince) || !fetchUntil.Equal(filterUntil)
 
 	listOpts := pagerduty.GetScheduleOptions{}
-	listOpts.Since = filterSince.Format(time.RFC3339)
-	listOpts.Until = filterUntil.Format(time.RFC3339)
+	listOpts.Since = fetchSince.Format(time.RFC3339)
+	listOpts.Until = fetchUntil.Format(time.RFC3339)
 
 	m.Logger().Debug("fetch schedule information", slog.String("schedule", scheduleID))
 
-	schedule, err := PagerDutyClient.GetScheduleWithContext(m.Context(), scheduleID, listOpts)
-	PrometheusPagerDutyApiCounter.WithLabelValues("GetSchedule").Inc()
-
+	schedule, err := m.client().GetScheduleWithContext(m.Context(), scheduleID, listOpts)
+	PrometheusPagerDutyApiCounter.WithLabelValues(m.account.Name, "GetSchedule").Inc()
 	if err != nil {
-		panic(err)
+		return m.handleError("GetSchedule", err)
 	}
 
 	scheduleLayerMetricList := m.Collector.GetMetricList("pagerduty_schedule_layer_info")
@@ -166,13 +264,16 @@ func (m *MetricsCollectorSchedule) collectScheduleInformation(scheduleID string,
 		for _, scheduleEntry := range scheduleLayer.RenderedScheduleEntries {
 			startTime, _ := time.Parse(time.RFC3339, scheduleEntry.Start)
 			endTime, _ := time.Parse(time.RFC3339, scheduleEntry.End)
+			if !scheduleEntryInTimeframe(startTime, endTime, filterSince, filterUntil) {
+				continue
+			}
 
 			// schedule item start
 			scheduleLayerEntryMetricList.AddTime(prometheus.Labels{
 				"scheduleID":      scheduleID,
 				"scheduleLayerID": scheduleLayer.ID,
 				"userID":          scheduleEntry.User.ID,
-				"time":            startTime.Format(Opts.PagerDuty.Schedule.EntryTimeFormat),
+				"time":            startTime.Format(m.opts.PagerDuty.Schedule.EntryTimeFormat),
 				"type":            "startTime",
 			}, startTime)
 
@@ -181,28 +282,35 @@ func (m *MetricsCollectorSchedule) collectScheduleInformation(scheduleID string,
 				"scheduleID":      scheduleID,
 				"scheduleLayerID": scheduleLayer.ID,
 				"userID":          scheduleEntry.User.ID,
-				"time":            endTime.Format(Opts.PagerDuty.Schedule.EntryTimeFormat),
+				"time":            endTime.Format(m.opts.PagerDuty.Schedule.EntryTimeFormat),
 				"type":            "endTime",
 			}, endTime)
 		}
 
-		// layer coverage
+		// layer coverage (of the entry timeframe)
+		layerCoverage := scheduleLayer.RenderedCoveragePercentage
+		if fetchWidened {
+			layerCoverage = onCallCoverage(renderedScheduleIntervals(scheduleLayer.RenderedScheduleEntries), filterSince, filterUntil)
+		}
 		scheduleLayerCoverageMetricList.Add(prometheus.Labels{
 			"scheduleID":      scheduleID,
 			"scheduleLayerID": scheduleLayer.ID,
-		}, scheduleLayer.RenderedCoveragePercentage)
+		}, layerCoverage)
 	}
 
 	// final schedule entries
 	for _, scheduleEntry := range schedule.FinalSchedule.RenderedScheduleEntries {
 		startTime, _ := time.Parse(time.RFC3339, scheduleEntry.Start)
 		endTime, _ := time.Parse(time.RFC3339, scheduleEntry.End)
+		if !scheduleEntryInTimeframe(startTime, endTime, filterSince, filterUntil) {
+			continue
+		}
 
 		// schedule item start
 		scheduleFinalEntryMetricList.AddTime(prometheus.Labels{
 			"scheduleID": scheduleID,
 			"userID":     scheduleEntry.User.ID,
-			"time":       startTime.Format(Opts.PagerDuty.Schedule.EntryTimeFormat),
+			"time":       startTime.Format(m.opts.PagerDuty.Schedule.EntryTimeFormat),
 			"type":       "startTime",
 		}, startTime)
 
@@ -210,20 +318,133 @@ func (m *MetricsCollectorSchedule) collectScheduleInformation(scheduleID string,
 		scheduleFinalEntryMetricList.AddTime(prometheus.Labels{
 			"scheduleID": scheduleID,
 			"userID":     scheduleEntry.User.ID,
-			"time":       endTime.Format(Opts.PagerDuty.Schedule.EntryTimeFormat),
+			"time":       endTime.Format(m.opts.PagerDuty.Schedule.EntryTimeFormat),
 			"type":       "endTime",
 		}, endTime)
 	}
 
-	// final schedule coverage
+	// final schedule coverage (of the entry timeframe)
+	finalIntervals := renderedScheduleIntervals(schedule.FinalSchedule.RenderedScheduleEntries)
+	finalCoverage := schedule.FinalSchedule.RenderedCoveragePercentage
+	if fetchWidened {
+		finalCoverage = onCallCoverage(finalIntervals, filterSince, filterUntil)
+	}
 	scheduleFinalCoverageMetricList.Add(prometheus.Labels{
 		"scheduleID": scheduleID,
-	}, schedule.FinalSchedule.RenderedCoveragePercentage)
+	}, finalCoverage)
+
+	m.collectScheduleGaps(scheduleID, finalIntervals, gapSince, gapUntil, now)
+
+	if onCallAccounting {
+		m.collectScheduleOnCallTime(schedule, now)
+	}
+
+	return nil
+}
+
+// scheduleEntryInTimeframe returns true if the schedule entry overlaps the timeframe
+func scheduleEntryInTimeframe(start, end, since, until time.Time) bool {
+	return end.After(since) && start.Before(until)
+}
+
+// renderedScheduleIntervals returns the intervals of the rendered schedule entries
+func renderedScheduleIntervals(entries []pagerduty.RenderedScheduleEntry) []onCallInterval {
+	ret := []onCallInterval{}
+	for _, scheduleEntry := range entries {
+		startTime, startErr := time.Parse(time.RFC3339, scheduleEntry.Start)
+		endTime, endErr := time.Parse(time.RFC3339, scheduleEntry.End)
+		if startErr != nil || endErr != nil {
+			continue
+		}
+		ret = append(ret, onCallInterval{start: startTime, end: endTime})
+	}
+	return ret
+}
+
+// collectScheduleGaps adds the uncovered intervals (gaps) of the final schedule which end after now, the current gap
+// (nobody oncall now) is exported without time label
+func (m *MetricsCollectorSchedule) collectScheduleGaps(scheduleID string, intervals []onCallInterval, since, until, now time.Time) {
+	scheduleGapStartMetricList := m.Collector.GetMetricList("pagerduty_schedule_gap_start_timestamp_seconds")
+	scheduleGapDurationMetricList := m.Collector.GetMetricList("pagerduty_schedule_gap_duration_seconds")
+
+	gaps, nextGap, uncovered := scheduleGaps(intervals, since, until, now)
+	for _, gap := range gaps {
+		// label of the current gap must not change while the gap is ongoing
+		gapLabels := prometheus.Labels{
+			"scheduleID": scheduleID,
+			"time":       "",
+		}
+		if !gap.current {
+			gapLabels["time"] = gap.start.Format(m.opts.PagerDuty.Schedule.EntryTimeFormat)
+		}
+		scheduleGapStartMetricList.AddTime(gapLabels, gap.start)
+		scheduleGapDurationMetricList.Add(gapLabels, gap.end.Sub(gap.start).Seconds())
+	}
+
+	// no next gap series if the schedule is covered for the whole gap timeframe
+	if len(gaps) > 0 {
+		m.Collector.GetMetricList("pagerduty_schedule_next_gap_seconds").Add(prometheus.Labels{
+			"scheduleID": scheduleID,
+		}, nextGap)
+	}
+
+	m.Collector.GetMetricList("pagerduty_schedule_uncovered_seconds").Add(prometheus.Labels{
+		"scheduleID": scheduleID,
+	}, uncovered)
 }
 
-func (m *MetricsCollectorSchedule) collectScheduleOverrides(scheduleID string, callback chan<- func()) {
-	filterSince := time.Now().Add(-Opts.ScrapeTime.General)
-	filterUntil := time.Now().Add(Opts.PagerDuty.Schedule.OverrideTimeframe)
+// collectScheduleOnCallTime accounts the oncall time per user of the final schedule in the time zone of the schedule
+// (schedule has to be fetched for the oncall lookback and lookahead timeframe)
+func (m *MetricsCollectorSchedule) collectScheduleOnCallTime(schedule *pagerduty.Schedule, now time.Time) {
+	filterSince := now.Add(-m.opts.PagerDuty.Schedule.OnCallLookBack)
+	filterUntil := now.Add(m.opts.PagerDuty.Schedule.OnCallLookAhead)
+
+	location, err := time.LoadLocation(schedule.TimeZone)
+	if err != nil {
+		m.Logger().Warn("unknown schedule time zone, using UTC for oncall time accounting", slog.String("schedule", schedule.ID), slog.String("timeZone", schedule.TimeZone))
+		location = time.UTC
+	}
+
+	userIntervals := map[string][]onCallInterval{}
+	for _, scheduleEntry := range schedule.FinalSchedule.RenderedScheduleEntries {
+		startTime, startErr := time.Parse(time.RFC3339, scheduleEntry.Start)
+		endTime, endErr := time.Parse(time.RFC3339, scheduleEntry.End)
+		if startErr != nil || endErr != nil || scheduleEntry.User.ID == "" {
+			continue
+		}
+
+		userIntervals[scheduleEntry.User.ID] = append(userIntervals[scheduleEntry.User.ID], onCallInterval{start: startTime, end: endTime})
+	}
+
+	scheduleUserOnCallMetricList := m.Collector.GetMetricList("pagerduty_schedule_user_oncall_seconds")
+
+	timeframes := map[string][2]time.Time{
+		"lookback":  {filterSince, now},
+		"lookahead": {now, filterUntil},
+	}
+	for timeframe, window := range timeframes {
+		if !window[1].After(window[0]) {
+			continue
+		}
+
+		for userID, intervals := range userIntervals {
+			for key, seconds := range splitOnCallTime(m.opts, mergeOnCallIntervals(intervals, window[0], window[1]), location) {
+				scheduleUserOnCallMetricList.Add(prometheus.Labels{
+					"scheduleID": schedule.ID,
+					"userID":     userID,
+					"timeframe":  timeframe,
+					"dayType":    key.dayType,
+					"hours":      key.hours,
+				}, seconds)
+			}
+		}
+	}
+
+}
+
+func (m *MetricsCollectorSchedule) collectScheduleOverrides(scheduleID string, callback chan<- func()) error {
+	filterSince := time.Now().Add(-m.opts.ScrapeTime.General)
+	filterUntil := time.Now().Add(m.opts.PagerDuty.Schedule.OverrideTimeframe)
 
 	listOpts := pagerduty.ListOverridesOptions{}
 	listOpts.Since = filterSince.Format(time.RFC3339)
@@ -233,11 +454,10 @@ func (m *MetricsCollectorSchedule) collectScheduleOverrides(scheduleID string, c
 
 	m.Logger().Debug("fetch schedule overrides", slog.String("schedule", scheduleID))
 
-	list, err := PagerDutyClient.ListOverridesWithContext(m.Context(), scheduleID, listOpts)
-	PrometheusPagerDutyApiCounter.WithLabelValues("ListOverrides").Inc()
-
+	list, err := m.client().ListOverridesWithContext(m.Context(), scheduleID, listOpts)
+	PrometheusPagerDutyApiCounter.WithLabelValues(m.account.Name, "ListOverrides").Inc()
 	if err != nil {
-		panic(err)
+		return m.handleError("ListOverrides", err)
 	}
 
 	for _, override := range list.Overrides {
@@ -258,4 +478,6 @@ func (m *MetricsCollectorSchedule) collectScheduleOverrides(scheduleID string, c
 			"type":       "endTime",
 		}, endTime)
 	}
+
+	return nil
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"log/slog"
+	"time"
 
 	"github.com/PagerDuty/go-pagerduty"
 	"github.com/prometheus/client_golang/prometheus"
@@ -9,22 +10,33 @@ import (
 )
 
 type MetricsCollectorService struct {
-	collector.Processor
+	PagerDutyProcessor
 
 	prometheus struct {
-		service *prometheus.GaugeVec
+		service                     *prometheus.GaugeVec
+		serviceStatus               *prometheus.GaugeVec
+		serviceConfig               *prometheus.GaugeVec
+		serviceAcknowledgeTimeout   *prometheus.GaugeVec
+		serviceAutoResolveTimeout   *prometheus.GaugeVec
+		serviceAlertGroupingTimeout *prometheus.GaugeVec
+		serviceLastIncident         *prometheus.GaugeVec
+		serviceIntegration          *prometheus.GaugeVec
 	}
-
-	teamListOpt []string
 }
 
+var (
+	// PagerDutyServiceStatuses are the possible statuses of a service
+	PagerDutyServiceStatuses = []string{"active", "warning", "critical", "maintenance", "disabled"}
+)
+
 func (m *MetricsCollectorService) Setup(collector *collector.Collector) {
 	m.Processor.Setup(collector)
 
 	m.prometheus.service = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "pagerduty_service_info",
-			Help: "PagerDuty service",
+			Name:        "pagerduty_service_info",
+			Help:        "PagerDuty service",
+			ConstLabels: m.constLabels(),
 		},
 		[]string{
 			"serviceID",
@@ -33,31 +45,137 @@ func (m *MetricsCollectorService) Setup(collector *collector.Collector) {
 			"serviceUrl",
 		},
 	)
-	m.Collector.RegisterMetricList("pagerduty_service_info", m.prometheus.service, true)
-}
+	m.registerMetricList("pagerduty_service_info", m.prometheus.service, true)
+
+	m.prometheus.serviceStatus = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "pagerduty_service_status",
+			Help:        "PagerDuty service status (1 = current status)",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{
+			"serviceID",
+			"status",
+		},
+	)
+	m.registerMetricList("pagerduty_service_status", m.prometheus.serviceStatus, true)
 
-func (m *MetricsCollectorService) Reset() {
+	m.prometheus.serviceConfig = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "pagerduty_service_config_info",
+			Help:        "PagerDuty service configuration",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{
+			"serviceID",
+			"escalationPolicyID",
+			"alertCreation",
+			"alertGrouping",
+			"urgencyRule",
+			"urgency",
+			"urgencyDuringSupportHours",
+			"urgencyOutsideSupportHours",
+		},
+	)
+	m.registerMetricList("pagerduty_service_config_info", m.prometheus.serviceConfig, true)
+
+	m.prometheus.serviceAcknowledgeTimeout = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "pagerduty_service_acknowledgement_timeout_seconds",
+			Help:        "PagerDuty service acknowledgement timeout (0 = disabled)",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{
+			"serviceID",
+		},
+	)
+	m.registerMetricList("pagerduty_service_acknowledgement_timeout_seconds", m.prometheus.serviceAcknowledgeTimeout, true)
+
+	m.prometheus.serviceAutoResolveTimeout = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "pagerduty_service_auto_resolve_timeout_seconds",
+			Help:        "PagerDuty service auto resolve timeout (0 = disabled)",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{
+			"serviceID",
+		},
+	)
+	m.registerMetricList("pagerduty_service_auto_resolve_timeout_seconds", m.prometheus.serviceAutoResolveTimeout, true)
+
+	m.prometheus.serviceAlertGroupingTimeout = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "pagerduty_service_alert_grouping_timeout_seconds",
+			Help:        "PagerDuty service alert grouping timeout (0 = disabled or grouping without timeout)",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{
+			"serviceID",
+		},
+	)
+	m.registerMetricList("pagerduty_service_alert_grouping_timeout_seconds", m.prometheus.serviceAlertGroupingTimeout, true)
+
+	m.prometheus.serviceLastIncident = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "pagerduty_service_last_incident_timestamp_seconds",
+			Help:        "PagerDuty service timestamp of the last incident (0 = no incident)",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{
+			"serviceID",
+		},
+	)
+	m.registerMetricList("pagerduty_service_last_incident_timestamp_seconds", m.prometheus.serviceLastIncident, true)
+
+	m.prometheus.serviceIntegration = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "pagerduty_service_integration_info",
+			Help:        "PagerDuty service integration",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{
+			"serviceID",
+			"integrationID",
+			"integrationName",
+			"type",
+			"vendor",
+		},
+	)
+	m.registerMetricList("pagerduty_service_integration_info", m.prometheus.serviceIntegration, true)
 }
 
 func (m *MetricsCollectorService) Collect(callback chan<- func()) {
+	m.run(func() error {
+		return m.collectServices(callback)
+	})
+}
+
+func (m *MetricsCollectorService) collectServices(callback chan<- func()) error {
 	listOpts := pagerduty.ListServiceOptions{}
 	listOpts.Limit = PagerdutyListLimit
 	listOpts.Offset = 0
+	listOpts.Includes = []string{"integrations"}
 
-	if len(m.teamListOpt) > 0 {
-		listOpts.TeamIDs = m.teamListOpt
+	if len(m.teamListOpt()) > 0 {
+		listOpts.TeamIDs = m.teamListOpt()
 	}
 
 	serviceMetricList := m.Collector.GetMetricList("pagerduty_service_info")
+	serviceStatusMetricList := m.Collector.GetMetricList("pagerduty_service_status")
+	serviceConfigMetricList := m.Collector.GetMetricList("pagerduty_service_config_info")
+	serviceAcknowledgeTimeoutMetricList := m.Collector.GetMetricList("pagerduty_service_acknowledgement_timeout_seconds")
+	serviceAutoResolveTimeoutMetricList := m.Collector.GetMetricList("pagerduty_service_auto_resolve_timeout_seconds")
+	serviceAlertGroupingTimeoutMetricList := m.Collector.GetMetricList("pagerduty_service_alert_grouping_timeout_seconds")
+	serviceLastIncidentMetricList := m.Collector.GetMetricList("pagerduty_service_last_incident_timestamp_seconds")
+	serviceIntegrationMetricList := m.Collector.GetMetricList("pagerduty_service_integration_info")
 
 	for {
 		m.Logger().Debug("fetch services ", slog.Uint64("offset", uint64(listOpts.Offset)), slog.Uint64("limit", uint64(listOpts.Limit)))
 
-		list, err := PagerDutyClient.ListServicesWithContext(m.Context(), listOpts)
-		PrometheusPagerDutyApiCounter.WithLabelValues("ListServices").Inc()
-
+		list, err := m.client().ListServicesWithContext(m.Context(), listOpts)
+		PrometheusPagerDutyApiCounter.WithLabelValues(m.account.Name, "ListServices").Inc()
 		if err != nil {
-			panic(err)
+			return m.handleError("ListServices", err)
 		}
 
 		for _, service := range list.Services {
@@ -79,6 +197,55 @@ func (m *MetricsCollectorService) Collect(callback chan<- func()) {
 					"serviceUrl":  service.HTMLURL,
 				})
 			}
+
+			// status
+			for _, status := range PagerDutyServiceStatuses {
+				serviceStatusMetricList.AddBool(prometheus.Labels{
+					"serviceID": service.ID,
+					"status":    status,
+				}, service.Status == status)
+			}
+
+			// config
+			serviceConfigMetricList.AddInfo(serviceConfigLabels(service))
+
+			// timeouts (null = disabled)
+			serviceAcknowledgeTimeoutMetricList.Add(prometheus.Labels{
+				"serviceID": service.ID,
+			}, uintPtrToFloat(service.AcknowledgementTimeout))
+
+			serviceAutoResolveTimeoutMetricList.Add(prometheus.Labels{
+				"serviceID": service.ID,
+			}, uintPtrToFloat(service.AutoResolveTimeout))
+
+			serviceAlertGroupingTimeoutMetricList.Add(prometheus.Labels{
+				"serviceID": service.ID,
+			}, serviceAlertGroupingTimeout(service).Seconds())
+
+			// last incident
+			lastIncident := float64(0)
+			if lastIncidentAt, err := time.Parse(time.RFC3339, service.LastIncidentTimestamp); err == nil {
+				lastIncident = float64(lastIncidentAt.Unix())
+			}
+			serviceLastIncidentMetricList.Add(prometheus.Labels{
+				"serviceID": service.ID,
+			}, lastIncident)
+
+			// integrations
+			for _, integration := range service.Integrations {
+				vendor := ""
+				if integration.Vendor != nil {
+					vendor = integration.Vendor.Summary
+				}
+
+				serviceIntegrationMetricList.AddInfo(prometheus.Labels{
+					"serviceID":       service.ID,
+					"integrationID":   integration.ID,
+					"integrationName": integration.Name,
+					"type":            integration.Type,
+					"vendor":          vendor,
+				})
+			}
 		}
 
 		listOpts.Offset += list.Limit
@@ -86,4 +253,54 @@ func (m *MetricsCollectorService) Collect(callback chan<- func()) {
 			break
 		}
 	}
+
+	return nil
+}
+
+// serviceAlertGrouping returns the alert grouping type of the service (alert grouping parameters or legacy setting)
+func serviceAlertGrouping(service pagerduty.Service) string {
+	if service.AlertGroupingParameters != nil && service.AlertGroupingParameters.Type != "" {
+		return service.AlertGroupingParameters.Type
+	}
+	return service.AlertGrouping
+}
+
+// serviceAlertGroupingTimeout returns the alert grouping timeout of the service (configured in minutes)
+func serviceAlertGroupingTimeout(service pagerduty.Service) time.Duration {
+	timeout := service.AlertGroupingTimeout
+	if service.AlertGroupingParameters != nil && service.AlertGroupingParameters.Config != nil && service.AlertGroupingParameters.Config.Timeout != nil {
+		timeout = service.AlertGroupingParameters.Config.Timeout
+	}
+
+	if timeout == nil {
+		return 0
+	}
+	return time.Duration(*timeout) * time.Minute
+}
+
+// serviceConfigLabels returns the configuration labels of the service
+func serviceConfigLabels(service pagerduty.Service) prometheus.Labels {
+	labels := prometheus.Labels{
+		"serviceID":                  service.ID,
+		"escalationPolicyID":         service.EscalationPolicy.ID,
+		"alertCreation":              service.AlertCreation,
+		"alertGrouping":              serviceAlertGrouping(service),
+		"urgencyRule":                "",
+		"urgency":                    "",
+		"urgencyDuringSupportHours":  "",
+		"urgencyOutsideSupportHours": "",
+	}
+
+	if rule := service.IncidentUrgencyRule; rule != nil {
+		labels["urgencyRule"] = rule.Type
+		labels["urgency"] = rule.Urgency
+		if rule.DuringSupportHours != nil {
+			labels["urgencyDuringSupportHours"] = rule.DuringSupportHours.Urgency
+		}
+		if rule.OutsideSupportHours != nil {
+			labels["urgencyOutsideSupportHours"] = rule.OutsideSupportHours.Urgency
+		}
+	}
+
+	return labels
 }
@@ -11,26 +11,55 @@ import (
 	"github.com/webdevops/go-common/prometheus/collector"
 )
 
-type MetricsCollectorSummary struct {
-	collector.Processor
+const (
+	// overlap of incremental log entry fetches, log entries may show up delayed
+	summaryLogEntryOverlap = 5 * time.Minute
 
-	prometheus struct {
-		incidentCount               *prometheus.GaugeVec
-		incidentResolveDuration     *prometheus.HistogramVec
-		incidentAcknowledgeDuration *prometheus.HistogramVec
-		incidentStatusChangeCount   *prometheus.CounterVec
+	// version of the persisted incident state, needs to be increased if the format or the meaning of the state changes
+	summaryStateVersion = "summary.v1"
+)
+
+type (
+	MetricsCollectorSummary struct {
+		PagerDutyProcessor
+
+		prometheus struct {
+			incidentCount               *prometheus.GaugeVec
+			incidentResolveDuration     *prometheus.HistogramVec
+			incidentAcknowledgeDuration *prometheus.HistogramVec
+			incidentStatusChangeCount   *prometheus.CounterVec
+		}
+
+		state     *summaryState
+		stateFile *stateFile
+		stateTag  string
 	}
 
-	teamListOpt []string
-}
+	summaryState struct {
+		Tag           string                           `json:"tag"`
+		HighWaterMark *time.Time                       `json:"highWaterMark"`
+		Incidents     map[string]*summaryIncidentState `json:"incidents"`
+	}
+
+	summaryIncidentState struct {
+		ServiceID      string     `json:"serviceID"`
+		Status         string     `json:"status"`
+		Urgency        string     `json:"urgency"`
+		Priority       string     `json:"priority"`
+		CreatedAt      time.Time  `json:"createdAt"`
+		AcknowledgedAt *time.Time `json:"acknowledgedAt,omitempty"`
+		ResolvedAt     *time.Time `json:"resolvedAt,omitempty"`
+	}
+)
 
 func (m *MetricsCollectorSummary) Setup(collector *collector.Collector) {
 	m.Processor.Setup(collector)
 
 	m.prometheus.incidentCount = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "pagerduty_summary_incident_count",
-			Help: "PagerDuty overall incident count for summary duration",
+			Name:        "pagerduty_summary_incident_count",
+			Help:        "PagerDuty overall incident count for summary duration",
+			ConstLabels: m.constLabels(),
 		},
 		[]string{
 			"serviceID",
@@ -39,12 +68,13 @@ func (m *MetricsCollectorSummary) Setup(collector *collector.Collector) {
 			"priority",
 		},
 	)
-	prometheus.MustRegister(m.prometheus.incidentCount)
+	mustRegisterMetricFamily("pagerduty_summary_incident_count", m.prometheus.incidentCount)
 
 	m.prometheus.incidentResolveDuration = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
-			Name: "pagerduty_summary_incident_resolve_duration",
-			Help: "PagerDuty overall incident resolve duration for summary duration",
+			Name:        "pagerduty_summary_incident_resolve_duration",
+			Help:        "PagerDuty overall incident resolve duration for summary duration",
+			ConstLabels: m.constLabels(),
 			Buckets: []float64{
 				5 * 60,            // 5 min
 				15 * 60,           // 15 min
@@ -66,12 +96,13 @@ func (m *MetricsCollectorSummary) Setup(collector *collector.Collector) {
 			"priority",
 		},
 	)
-	prometheus.MustRegister(m.prometheus.incidentResolveDuration)
+	mustRegisterMetricFamily("pagerduty_summary_incident_resolve_duration", m.prometheus.incidentResolveDuration)
 
 	m.prometheus.incidentAcknowledgeDuration = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
-			Name: "pagerduty_summary_incident_acknowledge_duration",
-			Help: "PagerDuty overall incident acknowledge duration for summary duration",
+			Name:        "pagerduty_summary_incident_acknowledge_duration",
+			Help:        "PagerDuty overall incident acknowledge duration for summary duration",
+			ConstLabels: m.constLabels(),
 			Buckets: []float64{
 				5 * 60,            // 5 min
 				15 * 60,           // 15 min
@@ -93,12 +124,13 @@ func (m *MetricsCollectorSummary) Setup(collector *collector.Collector) {
 			"priority",
 		},
 	)
-	prometheus.MustRegister(m.prometheus.incidentAcknowledgeDuration)
+	mustRegisterMetricFamily("pagerduty_summary_incident_acknowledge_duration", m.prometheus.incidentAcknowledgeDuration)
 
 	m.prometheus.incidentStatusChangeCount = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
-			Name: "pagerduty_summary_incident_statuschange_count",
-			Help: "PagerDuty number of observed status changes for incidents",
+			Name:        "pagerduty_summary_incident_statuschange_count",
+			Help:        "PagerDuty number of observed status changes for incidents",
+			ConstLabels: m.constLabels(),
 		},
 		[]string{
 			"serviceID",
@@ -107,134 +139,331 @@ func (m *MetricsCollectorSummary) Setup(collector *collector.Collector) {
 			"priority",
 		},
 	)
-	prometheus.MustRegister(m.prometheus.incidentStatusChangeCount)
+	mustRegisterMetricFamily("pagerduty_summary_incident_statuschange_count", m.prometheus.incidentStatusChangeCount)
 }
 
 func (m *MetricsCollectorSummary) Reset() {
+	m.PagerDutyProcessor.Reset()
 	m.prometheus.incidentCount.Reset()
 	m.prometheus.incidentResolveDuration.Reset()
 	m.prometheus.incidentAcknowledgeDuration.Reset()
 }
 
 func (m *MetricsCollectorSummary) Collect(callback chan<- func()) {
-	m.collectIncidents(callback)
+	m.run(func() error {
+		return m.collectIncidents(callback)
+	})
 }
 
-func (m *MetricsCollectorSummary) collectIncidents(callback chan<- func()) {
+func (m *MetricsCollectorSummary) collectIncidents(callback chan<- func()) error {
 	now := time.Now().UTC()
 
+	if m.state == nil {
+		m.loadState()
+	}
+
+	var err error
+	if m.state.HighWaterMark == nil {
+		err = m.fetchAllIncidents(now)
+	} else {
+		err = m.fetchChangedIncidents(now)
+	}
+	if err != nil {
+		// high-water mark is not moved, changes will be fetched again in next run
+		return err
+	}
+
+	m.state.HighWaterMark = &now
+	m.expireState(now)
+	if err := m.stateFile.Save(m.state); err != nil {
+		m.Logger().Warn("unable to save state", slog.Any("error", err))
+	}
+
+	m.collectMetrics(callback)
+
+	return nil
+}
+
+// loadState restores the incident state from the state file (if tag matches) or starts with an empty state
+func (m *MetricsCollectorSummary) loadState() {
+	state := &summaryState{}
+	if m.stateFile.Load(state) && state.Tag == m.stateTag && state.HighWaterMark != nil && state.Incidents != nil {
+		m.Logger().Info("restored incident state", slog.Int("incidents", len(state.Incidents)), slog.Time("highWaterMark", *state.HighWaterMark))
+		m.state = state
+		return
+	}
+
+	m.state = &summaryState{
+		Tag:       m.stateTag,
+		Incidents: map[string]*summaryIncidentState{},
+	}
+}
+
+// expireState removes incidents which are outside of the summary timeframe
+func (m *MetricsCollectorSummary) expireState(now time.Time) {
+	since := now.Add(-m.opts.PagerDuty.Summary.Since)
+	for incidentID, incident := range m.state.Incidents {
+		if incident.CreatedAt.Before(since) {
+			delete(m.state.Incidents, incidentID)
+		}
+	}
+}
+
+// fetchAllIncidents fetches all incidents of the summary timeframe (initial run without state)
+func (m *MetricsCollectorSummary) fetchAllIncidents(now time.Time) error {
 	listOpts := pagerduty.ListIncidentsOptions{
 		Includes: []string{"acknowledgers"},
 	}
 	listOpts.Limit = PagerdutyListLimit
-	listOpts.Since = now.Add(-Opts.PagerDuty.Summary.Since).Format(time.RFC3339)
+	listOpts.Since = now.Add(-m.opts.PagerDuty.Summary.Since).Format(time.RFC3339)
 	listOpts.Until = now.Format(time.RFC3339)
 	listOpts.Offset = 0
 	listOpts.Statuses = []string{"triggered", "acknowledged", "resolved"}
 
-	if len(m.teamListOpt) > 0 {
-		listOpts.TeamIDs = m.teamListOpt
+	if len(m.teamListOpt()) > 0 {
+		listOpts.TeamIDs = m.teamListOpt()
 	}
 
-	overallIncidentCountMetricList := prometheusCommon.NewHashedMetricsList()
-	overallIncidentResolveDurationMetricList := prometheusCommon.NewMetricsList()
-	overallIncidentAcknowledgeDurationMetricList := prometheusCommon.NewMetricsList()
-	changedIncidentCountMetricList := prometheusCommon.NewHashedMetricsList()
-
 	for {
-		m.Logger().Debug("fetch incidents (offset: %v, limit:%v, since:%v, until:%v)", slog.Uint64("offset", uint64(listOpts.Offset)), slog.Uint64("limit", uint64(listOpts.Limit)), slog.String("since", listOpts.Since), slog.String("until", listOpts.Until))
-
-		list, err := PagerDutyClient.ListIncidentsWithContext(m.Context(), listOpts)
-		PrometheusPagerDutyApiCounter.WithLabelValues("ListIncidents").Inc()
+		m.Logger().Debug("fetch incidents", slog.Uint64("offset", uint64(listOpts.Offset)), slog.Uint64("limit", uint64(listOpts.Limit)), slog.String("since", listOpts.Since), slog.String("until", listOpts.Until))
 
+		list, err := m.client().ListIncidentsWithContext(m.Context(), listOpts)
+		PrometheusPagerDutyApiCounter.WithLabelValues(m.account.Name, "ListIncidents").Inc()
 		if err != nil {
-			panic(err)
+			return m.handleError("ListIncidents", err)
 		}
 
 		for _, incident := range list.Incidents {
-			createdAt, _ := time.Parse(time.RFC3339, incident.CreatedAt)
-			resolvedAt, _ := time.Parse(time.RFC3339, incident.ResolvedAt)
-			acknowledgedAt := time.Now()
+			incidentState := m.state.updateIncident(incident)
+			if incidentState == nil {
+				continue
+			}
 
-			incidentLogEntries, err := PagerDutyClient.ListIncidentLogEntriesWithContext(m.Context(), incident.ID, pagerduty.ListIncidentLogEntriesOptions{
+			incidentLogEntries, err := m.client().ListIncidentLogEntriesWithContext(m.Context(), incident.ID, pagerduty.ListIncidentLogEntriesOptions{
 				Limit:      PagerdutyListLimit,
 				IsOverview: true,
 			})
+			PrometheusPagerDutyApiCounter.WithLabelValues(m.account.Name, "ListIncidentLogEntries").Inc()
 			if err != nil {
-				panic(err)
+				// keep incident without acknowledgement time if log entries are not available
+				if err := m.handleError("ListIncidentLogEntries", err); isAbortError(err) {
+					return err
+				}
+				continue
 			}
 
 			for _, entry := range incidentLogEntries.LogEntries {
-				at, _ := time.Parse(time.RFC3339, entry.CreatedAt)
-				if strings.HasPrefix(entry.Type, "acknowledge_log_entry") && acknowledgedAt.After(at) {
-					acknowledgedAt = at
-				}
+				incidentState.applyLogEntry(entry)
 			}
+		}
 
-			incidentPriority := ""
-			if incident.Priority != nil {
-				incidentPriority = incident.Priority.Name
-			}
+		listOpts.Offset += PagerdutyListLimit
+		if stopPagerdutyPaging(list.APIListObject) {
+			break
+		}
+	}
 
-			overallIncidentCountMetricList.Inc(prometheus.Labels{
-				"serviceID": incident.Service.ID,
-				"status":    incident.Status,
-				"urgency":   incident.Urgency,
-				"priority":  incidentPriority,
-			})
+	return nil
+}
+
+// fetchChangedIncidents fetches all log entries since the last high-water mark and applies them to the incident state
+func (m *MetricsCollectorSummary) fetchChangedIncidents(now time.Time) error {
+	listOpts := pagerduty.ListLogEntriesOptions{
+		Includes:   []string{"incidents"},
+		IsOverview: true,
+	}
+	listOpts.Limit = PagerdutyListLimit
+	listOpts.Since = m.state.HighWaterMark.Add(-summaryLogEntryOverlap).Format(time.RFC3339)
+	listOpts.Until = now.Format(time.RFC3339)
+	listOpts.Offset = 0
 
-			switch strings.ToLower(incident.Status) {
-			case "resolved":
-				// info
-				resolveDuration := resolvedAt.Sub(createdAt)
+	if len(m.teamListOpt()) > 0 {
+		listOpts.TeamIDs = m.teamListOpt()
+	}
 
-				overallIncidentResolveDurationMetricList.AddDuration(prometheus.Labels{
-					"serviceID": incident.Service.ID,
-					"urgency":   incident.Urgency,
-					"priority":  incidentPriority,
-				}, resolveDuration)
-				fallthrough
-			case "acknowledged":
-				// info
-				acknowledgeDuration := acknowledgedAt.Sub(createdAt)
-
-				overallIncidentAcknowledgeDurationMetricList.AddDuration(prometheus.Labels{
-					"serviceID": incident.Service.ID,
-					"urgency":   incident.Urgency,
-					"priority":  incidentPriority,
-				}, acknowledgeDuration)
+	for {
+		m.Logger().Debug("fetch log entries", slog.Uint64("offset", uint64(listOpts.Offset)), slog.Uint64("limit", uint64(listOpts.Limit)), slog.String("since", listOpts.Since), slog.String("until", listOpts.Until))
+
+		list, err := m.client().ListLogEntriesWithContext(m.Context(), listOpts)
+		PrometheusPagerDutyApiCounter.WithLabelValues(m.account.Name, "ListLogEntries").Inc()
+		if err != nil {
+			return m.handleError("ListLogEntries", err)
+		}
+
+		for _, entry := range list.LogEntries {
+			if entry.Incident.ID == "" {
+				continue
 			}
 
-			if m.GetLastScapeTime() != nil {
-				if createdAt.After(*m.GetLastScapeTime()) {
-					changedIncidentCountMetricList.Inc(prometheus.Labels{
-						"serviceID": incident.Service.ID,
-						"status":    "created",
-						"urgency":   incident.Urgency,
-						"priority":  incidentPriority,
-					})
-				} else if acknowledgedAt.After(*m.GetLastScapeTime()) || resolvedAt.After(*m.GetLastScapeTime()) {
-					changedIncidentCountMetricList.Inc(prometheus.Labels{
-						"serviceID": incident.Service.ID,
-						"status":    incident.Status,
-						"urgency":   incident.Urgency,
-						"priority":  incidentPriority,
-					})
-				}
+			incidentState, exists := m.state.Incidents[entry.Incident.ID]
+			if entry.Incident.CreatedAt != "" {
+				// log entry contains current incident details
+				incidentState = m.state.updateIncident(entry.Incident)
+			} else if !exists {
+				continue
+			}
+
+			if incidentState != nil {
+				incidentState.applyLogEntry(entry)
 			}
 		}
 
+		if list.More && list.Offset+list.Limit > PAGERDUTY_MAX_PAGING_LIMIT {
+			// too many changes for incremental fetching, start over with full fetch
+			// the high-water mark is reset together with the incidents, so a failing full fetch is retried in next run
+			m.Logger().Warn("too many log entries since last run, resetting incident state")
+			m.state.HighWaterMark = nil
+			m.state.Incidents = map[string]*summaryIncidentState{}
+			return m.fetchAllIncidents(now)
+		}
+
 		listOpts.Offset += PagerdutyListLimit
 		if stopPagerdutyPaging(list.APIListObject) {
 			break
 		}
 	}
 
+	return nil
+}
+
+// collectMetrics builds the summary metrics from the incident state
+func (m *MetricsCollectorSummary) collectMetrics(callback chan<- func()) {
+	overallIncidentCountMetricList := prometheusCommon.NewHashedMetricsList()
+	overallIncidentResolveDurationMetricList := prometheusCommon.NewMetricsList()
+	overallIncidentAcknowledgeDurationMetricList := prometheusCommon.NewMetricsList()
+	changedIncidentCountMetricList := prometheusCommon.NewHashedMetricsList()
+
+	lastScrapeTime := m.GetLastScapeTime()
+
+	for _, incident := range m.state.Incidents {
+		overallIncidentCountMetricList.Inc(prometheus.Labels{
+			"serviceID": incident.ServiceID,
+			"status":    incident.Status,
+			"urgency":   incident.Urgency,
+			"priority":  incident.Priority,
+		})
+
+		if incident.ResolvedAt != nil {
+			overallIncidentResolveDurationMetricList.AddDuration(prometheus.Labels{
+				"serviceID": incident.ServiceID,
+				"urgency":   incident.Urgency,
+				"priority":  incident.Priority,
+			}, incident.ResolvedAt.Sub(incident.CreatedAt))
+		}
+
+		if incident.AcknowledgedAt != nil {
+			overallIncidentAcknowledgeDurationMetricList.AddDuration(prometheus.Labels{
+				"serviceID": incident.ServiceID,
+				"urgency":   incident.Urgency,
+				"priority":  incident.Priority,
+			}, incident.AcknowledgedAt.Sub(incident.CreatedAt))
+		}
+
+		if lastScrapeTime != nil {
+			if incident.CreatedAt.After(*lastScrapeTime) {
+				changedIncidentCountMetricList.Inc(prometheus.Labels{
+					"serviceID": incident.ServiceID,
+					"status":    "created",
+					"urgency":   incident.Urgency,
+					"priority":  incident.Priority,
+				})
+			} else if (incident.AcknowledgedAt != nil && incident.AcknowledgedAt.After(*lastScrapeTime)) || (incident.ResolvedAt != nil && incident.ResolvedAt.After(*lastScrapeTime)) {
+				changedIncidentCountMetricList.Inc(prometheus.Labels{
+					"serviceID": incident.ServiceID,
+					"status":    incident.Status,
+					"urgency":   incident.Urgency,
+					"priority":  incident.Priority,
+				})
+			}
+		}
+	}
+
+	// metrics are not set by metric lists of the collector, guardrails are applied before setting them
+	incidentCountMetricList := prometheusCommon.NewMetricsList()
+	for _, row := range overallIncidentCountMetricList.GetList() {
+		incidentCountMetricList.Add(row.Labels, row.Value)
+	}
+	incidentCountEnabled := m.applyMetricListGuardrails("pagerduty_summary_incident_count", incidentCountMetricList)
+	resolveDurationEnabled := m.applyMetricListGuardrails("pagerduty_summary_incident_resolve_duration", overallIncidentResolveDurationMetricList)
+	acknowledgeDurationEnabled := m.applyMetricListGuardrails("pagerduty_summary_incident_acknowledge_duration", overallIncidentAcknowledgeDurationMetricList)
+
+	// status change counter is never reset, series limit applies to all series since start
+	statusChangeCountMetricList := prometheusCommon.NewMetricsList()
+	for _, row := range changedIncidentCountMetricList.GetList() {
+		if labels, admitted := m.admitCounterSeries("pagerduty_summary_incident_statuschange_count", row.Labels); admitted {
+			statusChangeCountMetricList.Add(labels, row.Value)
+		}
+	}
+
 	// set metrics
 	callback <- func() {
-		overallIncidentCountMetricList.GaugeSet(m.prometheus.incidentCount)
-		overallIncidentResolveDurationMetricList.HistogramSet(m.prometheus.incidentResolveDuration)
-		overallIncidentAcknowledgeDurationMetricList.HistogramSet(m.prometheus.incidentAcknowledgeDuration)
-		changedIncidentCountMetricList.CounterAdd(m.prometheus.incidentStatusChangeCount)
+		if incidentCountEnabled {
+			incidentCountMetricList.GaugeSet(m.prometheus.incidentCount)
+		}
+		if resolveDurationEnabled {
+			overallIncidentResolveDurationMetricList.HistogramSet(m.prometheus.incidentResolveDuration)
+		}
+		if acknowledgeDurationEnabled {
+			overallIncidentAcknowledgeDurationMetricList.HistogramSet(m.prometheus.incidentAcknowledgeDuration)
+		}
+		statusChangeCountMetricList.CounterAdd(m.prometheus.incidentStatusChangeCount)
+	}
+}
+
+// updateIncident creates or updates the incident state from incident details
+func (s *summaryState) updateIncident(incident pagerduty.Incident) *summaryIncidentState {
+	createdAt, err := time.Parse(time.RFC3339, incident.CreatedAt)
+	if err != nil {
+		return nil
+	}
+
+	incidentState, exists := s.Incidents[incident.ID]
+	if !exists {
+		incidentState = &summaryIncidentState{}
+		s.Incidents[incident.ID] = incidentState
+	}
+
+	incidentState.ServiceID = incident.Service.ID
+	incidentState.Status = incident.Status
+	incidentState.Urgency = incident.Urgency
+	incidentState.CreatedAt = createdAt
+
+	incidentState.Priority = ""
+	if incident.Priority != nil {
+		incidentState.Priority = incident.Priority.Name
+	}
+
+	if resolvedAt, err := time.Parse(time.RFC3339, incident.ResolvedAt); err == nil {
+		incidentState.ResolvedAt = &resolvedAt
+	}
+
+	for _, acknowledgement := range incident.Acknowledgements {
+		if acknowledgedAt, err := time.Parse(time.RFC3339, acknowledgement.At); err == nil {
+			if incidentState.AcknowledgedAt == nil || incidentState.AcknowledgedAt.After(acknowledgedAt) {
+				incidentState.AcknowledgedAt = &acknowledgedAt
+			}
+		}
+	}
+
+	return incidentState
+}
+
+// applyLogEntry updates acknowledge and resolve time of the incident state
+func (i *summaryIncidentState) applyLogEntry(entry pagerduty.LogEntry) {
+	at, err := time.Parse(time.RFC3339, entry.CreatedAt)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(entry.Type, "acknowledge_log_entry"):
+		if i.AcknowledgedAt == nil || i.AcknowledgedAt.After(at) {
+			i.AcknowledgedAt = &at
+		}
+	case strings.HasPrefix(entry.Type, "resolve_log_entry"):
+		if i.ResolvedAt == nil {
+			i.ResolvedAt = &at
+		}
+		i.Status = "resolved"
 	}
 }
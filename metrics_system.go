@@ -7,7 +7,7 @@ import (
 )
 
 type MetricsCollectorSystem struct {
-	collector.Processor
+	PagerDutyProcessor
 
 	prometheus struct {
 		license                     *prometheus.GaugeVec
@@ -21,8 +21,9 @@ func (m *MetricsCollectorSystem) Setup(collector *collector.Collector) {
 
 	m.prometheus.license = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "pagerduty_system_license_info",
-			Help: "PagerDuty license",
+			Name:        "pagerduty_system_license_info",
+			Help:        "PagerDuty license",
+			ConstLabels: m.constLabels(),
 		},
 		[]string{
 			"licenseID",
@@ -30,12 +31,13 @@ func (m *MetricsCollectorSystem) Setup(collector *collector.Collector) {
 			"licenseName",
 		},
 	)
-	m.Collector.RegisterMetricList("pagerduty_system_license", m.prometheus.license, true)
+	m.registerMetricList("pagerduty_system_license", m.prometheus.license, true)
 
 	m.prometheus.licenseCurrent = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "pagerduty_system_license_current",
-			Help: "PagerDuty license current value",
+			Name:        "pagerduty_system_license_current",
+			Help:        "PagerDuty license current value",
+			ConstLabels: m.constLabels(),
 		},
 		[]string{
 			"licenseID",
@@ -43,12 +45,13 @@ func (m *MetricsCollectorSystem) Setup(collector *collector.Collector) {
 			"licenseName",
 		},
 	)
-	m.Collector.RegisterMetricList("pagerduty_system_licenses_current", m.prometheus.licenseCurrent, true)
+	m.registerMetricList("pagerduty_system_licenses_current", m.prometheus.licenseCurrent, true)
 
 	m.prometheus.licenseAllocationsAvailable = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "pagerduty_system_license_allocations_available",
-			Help: "PagerDuty license allocations available",
+			Name:        "pagerduty_system_license_allocations_available",
+			Help:        "PagerDuty license allocations available",
+			ConstLabels: m.constLabels(),
 		},
 		[]string{
 			"licenseID",
@@ -56,13 +59,16 @@ func (m *MetricsCollectorSystem) Setup(collector *collector.Collector) {
 			"licenseName",
 		},
 	)
-	m.Collector.RegisterMetricList("pagerduty_system_license_allocations_available", m.prometheus.licenseAllocationsAvailable, true)
+	m.registerMetricList("pagerduty_system_license_allocations_available", m.prometheus.licenseAllocationsAvailable, true)
 }
 
-func (m *MetricsCollectorSystem) Reset() {
+func (m *MetricsCollectorSystem) Collect(callback chan<- func()) {
+	m.run(func() error {
+		return m.collectLicenses(callback)
+	})
 }
 
-func (m *MetricsCollectorSystem) Collect(callback chan<- func()) {
+func (m *MetricsCollectorSystem) collectLicenses(callback chan<- func()) error {
 	listOpts := pagerduty.ListServiceOptions{}
 	listOpts.Limit = PagerdutyListLimit
 	listOpts.Offset = 0
@@ -71,9 +77,10 @@ func (m *MetricsCollectorSystem) Collect(callback chan<- func()) {
 	licenseCurrentMetricList := m.Collector.GetMetricList("pagerduty_system_licenses_current")
 	licenseAllocationsAvailableMetricList := m.Collector.GetMetricList("pagerduty_system_license_allocations_available")
 
-	resp, err := PagerDutyClient.ListLicensesWithContext(m.Context())
+	resp, err := m.client().ListLicensesWithContext(m.Context())
+	PrometheusPagerDutyApiCounter.WithLabelValues(m.account.Name, "ListLicenses").Inc()
 	if err != nil {
-		panic(err)
+		return m.handleError("ListLicenses", err)
 	}
 
 	for _, license := range resp.Licenses {
@@ -95,4 +102,6 @@ func (m *MetricsCollectorSystem) Collect(callback chan<- func()) {
 			"licenseName": license.Name,
 		}, float64(license.AllocationsAvailable))
 	}
+
+	return nil
 }
@@ -9,7 +9,7 @@ import (
 )
 
 type MetricsCollectorTeam struct {
-	collector.Processor
+	PagerDutyProcessor
 
 	prometheus struct {
 		team       *prometheus.GaugeVec
@@ -22,8 +22,9 @@ func (m *MetricsCollectorTeam) Setup(collector *collector.Collector) {
 
 	m.prometheus.team = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "pagerduty_team_info",
-			Help: "PagerDuty team",
+			Name:        "pagerduty_team_info",
+			Help:        "PagerDuty team",
+			ConstLabels: m.constLabels(),
 		},
 		[]string{
 			"teamID",
@@ -31,24 +32,28 @@ func (m *MetricsCollectorTeam) Setup(collector *collector.Collector) {
 			"teamUrl",
 		},
 	)
-	m.Collector.RegisterMetricList("pagerduty_team_info", m.prometheus.team, true)
+	m.registerMetricList("pagerduty_team_info", m.prometheus.team, true)
 
 	m.prometheus.teamMember = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "pagerduty_team_member_info",
-			Help: "PagerDuty team member information",
+			Name:        "pagerduty_team_member_info",
+			Help:        "PagerDuty team member information",
+			ConstLabels: m.constLabels(),
 		},
 		[]string{
 			"teamID", "userID", "role",
 		},
 	)
-	m.Collector.RegisterMetricList("pagerduty_team_member_info", m.prometheus.teamMember, true)
+	m.registerMetricList("pagerduty_team_member_info", m.prometheus.teamMember, true)
 }
 
-func (m *MetricsCollectorTeam) Reset() {
+func (m *MetricsCollectorTeam) Collect(callback chan<- func()) {
+	m.run(func() error {
+		return m.collectTeams(callback)
+	})
 }
 
-func (m *MetricsCollectorTeam) Collect(callback chan<- func()) {
+func (m *MetricsCollectorTeam) collectTeams(callback chan<- func()) error {
 	listOpts := pagerduty.ListTeamOptions{}
 	listOpts.Limit = PagerdutyListLimit
 	listOpts.Offset = 0
@@ -59,11 +64,10 @@ func (m *MetricsCollectorTeam) Collect(callback chan<- func()) {
 	for {
 		m.Logger().Debug("fetch teams", slog.Uint64("offset", uint64(listOpts.Offset)), slog.Uint64("limit", uint64(listOpts.Limit)))
 
-		list, err := PagerDutyClient.ListTeamsWithContext(m.Context(), listOpts)
-		PrometheusPagerDutyApiCounter.WithLabelValues("ListTeams").Inc()
-
+		list, err := m.client().ListTeamsWithContext(m.Context(), listOpts)
+		PrometheusPagerDutyApiCounter.WithLabelValues(m.account.Name, "ListTeams").Inc()
 		if err != nil {
-			panic(err)
+			return m.handleError("ListTeams", err)
 		}
 
 		for _, team := range list.Teams {
@@ -73,11 +77,13 @@ func (m *MetricsCollectorTeam) Collect(callback chan<- func()) {
 				"teamUrl":  team.HTMLURL,
 			})
 
-			members, err := PagerDutyClient.ListTeamMembersPaginated(m.Context(), team.ID)
-			PrometheusPagerDutyApiCounter.WithLabelValues("ListTeamMemberships").Inc()
+			members, err := m.client().ListTeamMembersPaginated(m.Context(), team.ID)
+			PrometheusPagerDutyApiCounter.WithLabelValues(m.account.Name, "ListTeamMemberships").Inc()
 			if err != nil {
-				m.Logger().Error("error fetching team members", slog.String("team", team.ID), slog.Any("error", err))
-				break
+				if err := m.handleError("ListTeamMemberships", err); isAbortError(err) {
+					return err
+				}
+				continue
 			}
 			for _, member := range members {
 				teamMembersMetricList.AddInfo(prometheus.Labels{
@@ -93,4 +99,6 @@ func (m *MetricsCollectorTeam) Collect(callback chan<- func()) {
 			break
 		}
 	}
+
+	return nil
 }
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/PagerDuty/go-pagerduty"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/webdevops/go-common/prometheus/collector"
+)
+
+const (
+	// log entry type for all types which are not classified
+	timelineTypeOther = "other"
+)
+
+var (
+	// classified log entry types (type of the log entry without "_log_entry" suffix)
+	timelineTypes = []string{
+		"trigger",
+		"acknowledge",
+		"unacknowledge",
+		"assign",
+		"reassign",
+		"delegate",
+		"escalate",
+		"notify",
+		"annotate",
+		"responder_request",
+		"snooze",
+		"urgency_change",
+		"resolve",
+	}
+)
+
+type (
+	MetricsCollectorTimeline struct {
+		PagerDutyProcessor
+
+		prometheus struct {
+			incidentLogEntries   *prometheus.GaugeVec
+			incidentFirstSeconds *prometheus.GaugeVec
+			serviceIncidents     *prometheus.GaugeVec
+			serviceLogEntries    *prometheus.GaugeVec
+			serviceFirstSeconds  *prometheus.GaugeVec
+		}
+	}
+
+	// timelineIncident is the classified log entry timeline of an incident
+	timelineIncident struct {
+		serviceID string
+		// count of log entries per type
+		logEntries map[string]float64
+		// duration from incident creation to the first log entry per type
+		firstSeconds map[string]float64
+	}
+
+	// timelineService are the timeline aggregates of the incidents of a service
+	timelineService struct {
+		incidents         float64
+		logEntries        map[string]float64
+		firstSecondsSum   map[string]float64
+		firstSecondsCount map[string]float64
+	}
+)
+
+func (m *MetricsCollectorTimeline) Setup(collector *collector.Collector) {
+	m.Processor.Setup(collector)
+
+	m.prometheus.incidentLogEntries = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "pagerduty_incident_timeline_log_entries",
+			Help:        "PagerDuty count of incident log entries per type",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{
+			"incidentID",
+			"serviceID",
+			"type",
+		},
+	)
+	m.registerMetricList("pagerduty_incident_timeline_log_entries", m.prometheus.incidentLogEntries, true)
+
+	m.prometheus.incidentFirstSeconds = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "pagerduty_incident_timeline_first_seconds",
+			Help:        "PagerDuty duration from incident creation to the first log entry per type",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{
+			"incidentID",
+			"serviceID",
+			"type",
+		},
+	)
+	m.registerMetricList("pagerduty_incident_timeline_first_seconds", m.prometheus.incidentFirstSeconds, true)
+
+	m.prometheus.serviceIncidents = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "pagerduty_service_timeline_incidents",
+			Help:        "PagerDuty count of incidents of the service in the timeline timeframe",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{
+			"serviceID",
+		},
+	)
+	m.registerMetricList("pagerduty_service_timeline_incidents", m.prometheus.serviceIncidents, true)
+
+	m.prometheus.serviceLogEntries = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "pagerduty_service_timeline_log_entries",
+			Help:        "PagerDuty count of incident log entries of the service per type",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{
+			"serviceID",
+			"type",
+		},
+	)
+	m.registerMetricList("pagerduty_service_timeline_log_entries", m.prometheus.serviceLogEntries, true)
+
+	m.prometheus.serviceFirstSeconds = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name:        "pagerduty_service_timeline_first_seconds_avg",
+			Help:        "PagerDuty average duration from incident creation to the first log entry per type of the service",
+			ConstLabels: m.constLabels(),
+		},
+		[]string{
+			"serviceID",
+			"type",
+		},
+	)
+	m.registerMetricList("pagerduty_service_timeline_first_seconds_avg", m.prometheus.serviceFirstSeconds, true)
+}
+
+func (m *MetricsCollectorTimeline) Collect(callback chan<- func()) {
+	m.run(func() error {
+		return m.collectTimeline(callback)
+	})
+}
+
+func (m *MetricsCollectorTimeline) collectTimeline(callback chan<- func()) error {
+	now := time.Now()
+
+	incidentLimit := m.opts.PagerDuty.Timeline.Limit
+
+	listOpts := pagerduty.ListIncidentsOptions{}
+	listOpts.Limit = min(PagerdutyListLimit, incidentLimit)
+	listOpts.Since = now.Add(-m.opts.PagerDuty.Timeline.Since).Format(time.RFC3339)
+	listOpts.Until = now.Format(time.RFC3339)
+	listOpts.Offset = 0
+	listOpts.Statuses = []string{"triggered", "acknowledged", "resolved"}
+	listOpts.SortBy = "created_at:desc"
+
+	if len(m.teamListOpt()) > 0 {
+		listOpts.TeamIDs = m.teamListOpt()
+	}
+
+	incidentLogEntriesMetricList := m.Collector.GetMetricList("pagerduty_incident_timeline_log_entries")
+	incidentFirstSecondsMetricList := m.Collector.GetMetricList("pagerduty_incident_timeline_first_seconds")
+
+	services := map[string]*timelineService{}
+
+	for incidentLimit > 0 {
+		m.Logger().Debug("fetch incidents", slog.Uint64("offset", uint64(listOpts.Offset)), slog.Uint64("limit", uint64(listOpts.Limit)), slog.String("since", listOpts.Since), slog.String("until", listOpts.Until))
+
+		list, err := m.client().ListIncidentsWithContext(m.Context(), listOpts)
+		PrometheusPagerDutyApiCounter.WithLabelValues(m.account.Name, "ListIncidents").Inc()
+		if err != nil {
+			return m.handleError("ListIncidents", err)
+		}
+
+		for _, incident := range list.Incidents {
+			timeline, err := m.fetchIncidentTimeline(incident)
+			if err != nil {
+				if isAbortError(err) {
+					return err
+				}
+				// incident might have been merged in the meantime
+				continue
+			}
+
+			for logEntryType, count := range timeline.logEntries {
+				incidentLogEntriesMetricList.Add(prometheus.Labels{
+					"incidentID": incident.ID,
+					"serviceID":  timeline.serviceID,
+					"type":       logEntryType,
+				}, count)
+			}
+
+			for logEntryType, seconds := range timeline.firstSeconds {
+				incidentFirstSecondsMetricList.Add(prometheus.Labels{
+					"incidentID": incident.ID,
+					"serviceID":  timeline.serviceID,
+					"type":       logEntryType,
+				}, seconds)
+			}
+
+			service, exists := services[timeline.serviceID]
+			if !exists {
+				service = &timelineService{
+					logEntries:        map[string]float64{},
+					firstSecondsSum:   map[string]float64{},
+					firstSecondsCount: map[string]float64{},
+				}
+				services[timeline.serviceID] = service
+			}
+			service.add(timeline)
+		}
+
+		listOpts.Offset += listOpts.Limit
+		if stopPagerdutyPaging(list.APIListObject) || listOpts.Offset >= incidentLimit {
+			break
+		}
+		listOpts.Limit = min(PagerdutyListLimit, incidentLimit-listOpts.Offset)
+	}
+
+	m.collectServices(services)
+
+	return nil
+}
+
+// fetchIncidentTimeline fetches and classifies all log entries of the incident
+func (m *MetricsCollectorTimeline) fetchIncidentTimeline(incident pagerduty.Incident) (*timelineIncident, error) {
+	timeline := &timelineIncident{
+		serviceID:    incident.Service.ID,
+		logEntries:   map[string]float64{},
+		firstSeconds: map[string]float64{},
+	}
+
+	createdAt, _ := time.Parse(time.RFC3339, incident.CreatedAt)
+
+	listOpts := pagerduty.ListIncidentLogEntriesOptions{}
+	listOpts.Limit = PagerdutyListLimit
+	listOpts.Offset = 0
+
+	for {
+		m.Logger().Debug("fetch incident log entries", slog.String("incident", incident.ID), slog.Uint64("offset", uint64(listOpts.Offset)), slog.Uint64("limit", uint64(listOpts.Limit)))
+
+		list, err := m.client().ListIncidentLogEntriesWithContext(m.Context(), incident.ID, listOpts)
+		PrometheusPagerDutyApiCounter.WithLabelValues(m.account.Name, "ListIncidentLogEntries").Inc()
+		if err != nil {
+			return nil, m.handleError("ListIncidentLogEntries", err)
+		}
+
+		for _, entry := range list.LogEntries {
+			logEntryType := timelineLogEntryType(entry.Type)
+			timeline.logEntries[logEntryType]++
+
+			if logEntryType == "trigger" || logEntryType == timelineTypeOther || createdAt.IsZero() {
+				continue
+			}
+
+			if at, err := time.Parse(time.RFC3339, entry.CreatedAt); err == nil {
+				seconds := max(at.Sub(createdAt).Seconds(), 0)
+				if val, exists := timeline.firstSeconds[logEntryType]; !exists || seconds < val {
+					timeline.firstSeconds[logEntryType] = seconds
+				}
+			}
+		}
+
+		listOpts.Offset += PagerdutyListLimit
+		if stopPagerdutyPaging(list.APIListObject) {
+			break
+		}
+	}
+
+	return timeline, nil
+}
+
+// collectServices adds the timeline aggregates of the services
+func (m *MetricsCollectorTimeline) collectServices(services map[string]*timelineService) {
+	serviceIncidentsMetricList := m.Collector.GetMetricList("pagerduty_service_timeline_incidents")
+	serviceLogEntriesMetricList := m.Collector.GetMetricList("pagerduty_service_timeline_log_entries")
+	serviceFirstSecondsMetricList := m.Collector.GetMetricList("pagerduty_service_timeline_first_seconds_avg")
+
+	for serviceID, service := range services {
+		serviceIncidentsMetricList.Add(prometheus.Labels{
+			"serviceID": serviceID,
+		}, service.incidents)
+
+		for logEntryType, count := range service.logEntries {
+			serviceLogEntriesMetricList.Add(prometheus.Labels{
+				"serviceID": serviceID,
+				"type":      logEntryType,
+			}, count)
+		}
+
+		for logEntryType, sum := range service.firstSecondsSum {
+			serviceFirstSecondsMetricList.Add(prometheus.Labels{
+				"serviceID": serviceID,
+				"type":      logEntryType,
+			}, sum/service.firstSecondsCount[logEntryType])
+		}
+	}
+}
+
+// add adds the incident timeline to the service aggregates
+func (s *timelineService) add(timeline *timelineIncident) {
+	s.incidents++
+
+	for logEntryType, count := range timeline.logEntries {
+		s.logEntries[logEntryType] += count
+	}
+
+	for logEntryType, seconds := range timeline.firstSeconds {
+		s.firstSecondsSum[logEntryType] += seconds
+		s.firstSecondsCount[logEntryType]++
+	}
+}
+
+// timelineLogEntryType returns the classified type of the log entry type (eg. "annotate" for "annotate_log_entry")
+func timelineLogEntryType(logEntryType string) string {
+	logEntryType = strings.TrimSuffix(logEntryType, "_log_entry_reference")
+	logEntryType = strings.TrimSuffix(logEntryType, "_log_entry")
+
+	if slices.Contains(timelineTypes, logEntryType) {
+		return logEntryType
+	}
+	return timelineTypeOther
+}
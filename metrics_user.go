@@ -9,13 +9,11 @@ import (
 )
 
 type MetricsCollectorUser struct {
-	collector.Processor
+	PagerDutyProcessor
 
 	prometheus struct {
 		user *prometheus.GaugeVec
 	}
-
-	teamListOpt []string
 }
 
 func (m *MetricsCollectorUser) Setup(collector *collector.Collector) {
@@ -23,8 +21,9 @@ func (m *MetricsCollectorUser) Setup(collector *collector.Collector) {
 
 	m.prometheus.user = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
-			Name: "pagerduty_user_info",
-			Help: "PagerDuty user",
+			Name:        "pagerduty_user_info",
+			Help:        "PagerDuty user",
+			ConstLabels: m.constLabels(),
 		},
 		[]string{
 			"userID",
@@ -37,44 +36,43 @@ func (m *MetricsCollectorUser) Setup(collector *collector.Collector) {
 			"userTimezone",
 		},
 	)
-	m.Collector.RegisterMetricList("pagerduty_user_info", m.prometheus.user, true)
+	m.registerMetricList("pagerduty_user_info", m.prometheus.user, true)
 }
 
-func (m *MetricsCollectorUser) Reset() {
+func (m *MetricsCollectorUser) Collect(callback chan<- func()) {
+	m.run(func() error {
+		return m.collectUsers(callback)
+	})
 }
 
-func (m *MetricsCollectorUser) Collect(callback chan<- func()) {
+func (m *MetricsCollectorUser) collectUsers(callback chan<- func()) error {
 	listOpts := pagerduty.ListUsersOptions{}
 	listOpts.Limit = PagerdutyListLimit
 	listOpts.Offset = 0
 
-	if len(m.teamListOpt) > 0 {
-		listOpts.TeamIDs = m.teamListOpt
+	if len(m.teamListOpt()) > 0 {
+		listOpts.TeamIDs = m.teamListOpt()
 	}
 
 	userMetricList := m.Collector.GetMetricList("pagerduty_user_info")
+	userTimeZones := map[string]string{}
 
 	for {
 		m.Logger().Debug("fetch users", slog.Uint64("offset", uint64(listOpts.Offset)), slog.Uint64("limit", uint64(listOpts.Limit)))
 
-		list, err := PagerDutyClient.ListUsersWithContext(m.Context(), listOpts)
-		PrometheusPagerDutyApiCounter.WithLabelValues("ListUsers").Inc()
-
+		list, err := m.client().ListUsersWithContext(m.Context(), listOpts)
+		PrometheusPagerDutyApiCounter.WithLabelValues(m.account.Name, "ListUsers").Inc()
 		if err != nil {
-			panic(err)
+			return m.handleError("ListUsers", err)
 		}
 
 		for _, user := range list.Users {
-			userMetricList.AddInfo(prometheus.Labels{
-				"userID":       user.ID,
-				"userName":     user.Name,
-				"userMail":     user.Email,
-				"userAvatar":   user.AvatarURL,
-				"userColor":    user.Color,
-				"userJobTitle": user.JobTitle,
-				"userRole":     user.Role,
-				"userTimezone": user.Timezone,
-			})
+			userLabels := piiUserLabels(m.opts, user)
+			userLabels["userColor"] = user.Color
+			userLabels["userRole"] = user.Role
+			userLabels["userTimezone"] = user.Timezone
+			userMetricList.AddInfo(userLabels)
+			userTimeZones[user.ID] = user.Timezone
 		}
 
 		listOpts.Offset += list.Limit
@@ -82,4 +80,8 @@ func (m *MetricsCollectorUser) Collect(callback chan<- func()) {
 			break
 		}
 	}
+
+	m.account.setUserTimeZones(userTimeZones)
+
+	return nil
 }
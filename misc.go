@@ -32,3 +32,26 @@ func boolToString(b bool) string {
 func uintToString(v uint) string {
 	return strconv.FormatUint(uint64(v), 10)
 }
+
+// uintPtrToFloat returns the value as float (0 for nil)
+func uintPtrToFloat(v *uint) float64 {
+	if v == nil {
+		return 0
+	}
+	return float64(*v)
+}
+
+// truncateString truncates the string to length characters (including the suffix)
+func truncateString(s string, length int, suffix string) string {
+	runes := []rune(s)
+	if len(runes) <= length {
+		return s
+	}
+
+	suffixRunes := []rune(suffix)
+	if length <= len(suffixRunes) {
+		return string(runes[:length])
+	}
+
+	return string(runes[:length-len(suffixRunes)]) + suffix
+}
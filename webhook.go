@@ -0,0 +1,373 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/PagerDuty/go-pagerduty"
+	"github.com/PagerDuty/go-pagerduty/webhookv3"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	prometheusCommon "github.com/webdevops/go-common/prometheus"
+	"github.com/webdevops/go-common/prometheus/collector"
+
+	"github.com/webdevops/pagerduty-exporter/config"
+)
+
+type (
+	// WebhookReceiver receives PagerDuty v3 webhooks and updates the incident metrics in real time,
+	// the incident collector still reconciles the metrics on every run
+	WebhookReceiver struct {
+		incidentCollectors map[string]*MetricsCollectorIncident
+
+		prometheus struct {
+			events *prometheus.CounterVec
+		}
+	}
+
+	webhookAccountHandler struct {
+		receiver          *WebhookReceiver
+		account           string
+		incidentCollector *MetricsCollectorIncident
+	}
+
+	webhookPayload struct {
+		Event webhookEvent `json:"event"`
+	}
+
+	webhookEvent struct {
+		ID           string               `json:"id"`
+		EventType    string               `json:"event_type"`
+		ResourceType string               `json:"resource_type"`
+		OccurredAt   string               `json:"occurred_at"`
+		Agent        *pagerduty.APIObject `json:"agent"`
+		Data         webhookIncident      `json:"data"`
+	}
+
+	webhookIncident struct {
+		pagerduty.APIObject
+		Number    uint                  `json:"number"`
+		Status    string                `json:"status"`
+		Title     string                `json:"title"`
+		Urgency   string                `json:"urgency"`
+		CreatedAt string                `json:"created_at"`
+		Service   pagerduty.APIObject   `json:"service"`
+		Assignees []pagerduty.APIObject `json:"assignees"`
+		Teams     []pagerduty.APIObject `json:"teams"`
+
+		EscalationPolicy pagerduty.APIObject  `json:"escalation_policy"`
+		Priority         *pagerduty.APIObject `json:"priority"`
+	}
+)
+
+func NewWebhookReceiver() *WebhookReceiver {
+	w := &WebhookReceiver{
+		incidentCollectors: map[string]*MetricsCollectorIncident{},
+	}
+
+	w.prometheus.events = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "pagerduty_webhook_events_total",
+			Help: "PagerDuty webhook events received",
+		},
+		[]string{
+			"account",
+			"eventType",
+			"result",
+		},
+	)
+	prometheus.MustRegister(w.prometheus.events)
+
+	return w
+}
+
+// AddAccount enables the webhook receiver for the incident collector of the account
+func (w *WebhookReceiver) AddAccount(account *PagerDutyAccount, incidentCollector *MetricsCollectorIncident) {
+	w.incidentCollectors[account.Name] = incidentCollector
+}
+
+// Register adds the webhook handlers to the mux, with multiple accounts every account has its own path (path/account)
+func (w *WebhookReceiver) Register(mux *http.ServeMux, path string) {
+	for accountName, incidentCollector := range w.incidentCollectors {
+		accountPath := path
+		if isMultiAccount() {
+			accountPath = strings.TrimSuffix(path, "/") + "/" + accountName
+		}
+
+		logger.Info("starting PagerDuty webhook receiver", slog.String("account", accountName), slog.String("path", accountPath))
+		mux.Handle(accountPath, &webhookAccountHandler{receiver: w, account: accountName, incidentCollector: incidentCollector})
+	}
+}
+
+func (h *webhookAccountHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	w := h.receiver
+
+	// secrets and incident options might be changed by a config reload
+	opts := currentConfig()
+
+	if req.Method != http.MethodPost {
+		http.Error(resp, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !w.verifySignature(opts, req) {
+		w.prometheus.events.WithLabelValues(h.account, "", "rejected").Inc()
+		http.Error(resp, "invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	payload := webhookPayload{}
+	if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+		w.prometheus.events.WithLabelValues(h.account, "", "invalid").Inc()
+		http.Error(resp, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	result := "ignored"
+	if h.applyEvent(opts, payload.Event) {
+		result = "applied"
+	}
+	w.prometheus.events.WithLabelValues(h.account, payload.Event.EventType, result).Inc()
+
+	logger.Debug("received PagerDuty webhook", slog.String("account", h.account), slog.String("event", payload.Event.EventType), slog.String("incident", payload.Event.Data.ID), slog.String("result", result))
+
+	resp.WriteHeader(http.StatusNoContent)
+}
+
+// verifySignature checks the webhook signature against all configured secrets (eg. during secret rotation)
+func (w *WebhookReceiver) verifySignature(opts *config.Opts, req *http.Request) bool {
+	for _, secret := range opts.PagerDuty.Webhook.Secrets {
+		// VerifySignature restores the request body, so it can be read multiple times
+		err := webhookv3.VerifySignature(req, secret)
+		if err == nil {
+			return true
+		}
+
+		if err != webhookv3.ErrNoValidSignatures {
+			logger.Debug("invalid PagerDuty webhook request", slog.Any("error", err))
+			return false
+		}
+	}
+
+	return false
+}
+
+// applyEvent updates the incident metrics, returns false if the event was ignored
+func (h *webhookAccountHandler) applyEvent(opts *config.Opts, event webhookEvent) bool {
+	if event.ResourceType != "incident" || event.Data.ID == "" {
+		return false
+	}
+
+	// settings of the collector run might be outdated or changed by a concurrent run
+	teamFilter := h.incidentCollector.account.currentSettings().TeamFilter
+	if len(teamFilter) > 0 {
+		if !slices.ContainsFunc(event.Data.Teams, func(team pagerduty.APIObject) bool {
+			return slices.Contains(teamFilter, team.ID)
+		}) {
+			return false
+		}
+	}
+
+	occurredAt := event.OccurredAt
+	if parsedTime, err := time.Parse(time.RFC3339, occurredAt); err == nil {
+		occurredAt = parsedTime.UTC().Format(time.RFC3339)
+	}
+
+	agent := pagerduty.APIObject{}
+	if event.Agent != nil {
+		agent = *event.Agent
+	}
+
+	incident := pagerduty.Incident{
+		APIObject:          event.Data.APIObject,
+		IncidentNumber:     event.Data.Number,
+		Title:              event.Data.Title,
+		CreatedAt:          event.Data.CreatedAt,
+		Service:            event.Data.Service,
+		Status:             event.Data.Status,
+		Urgency:            event.Data.Urgency,
+		EscalationPolicy:   event.Data.EscalationPolicy,
+		Teams:              event.Data.Teams,
+		LastStatusChangeAt: occurredAt,
+		LastStatusChangeBy: agent,
+	}
+
+	// webhook payload only contains the priority reference, the summary is the priority name
+	if event.Data.Priority != nil {
+		incident.Priority = &pagerduty.Priority{APIObject: *event.Data.Priority, Name: event.Data.Priority.Summary}
+	}
+
+	eventType := strings.TrimPrefix(event.EventType, "incident.")
+	replaceAssignments := false
+	switch eventType {
+	case "acknowledged":
+		incident.Acknowledgements = []pagerduty.Acknowledgement{{At: occurredAt, Acknowledger: agent}}
+	case "triggered", "reassigned", "escalated", "delegated", "reopened":
+		replaceAssignments = true
+		for _, assignee := range event.Data.Assignees {
+			incident.Assignments = append(incident.Assignments, pagerduty.Assignment{At: occurredAt, Assignee: assignee})
+		}
+	}
+
+	incidentMetricList := prometheusCommon.NewMetricsList()
+	incidentTeamMetricList := prometheusCommon.NewMetricsList()
+	incidentStatusMetricList := prometheusCommon.NewMetricsList()
+	h.incidentCollector.addIncident(opts, incidentMetricList, incidentTeamMetricList, incidentStatusMetricList, incident)
+
+	// ensure metrics are not updated while a collector writes its metrics
+	collector.Lock().Lock()
+	defer collector.Lock().Unlock()
+
+	incidentMetric := h.incidentCollector.prometheus.incident
+	incidentTeamMetric := h.incidentCollector.prometheus.incidentTeam
+	incidentStatusMetric := h.incidentCollector.prometheus.incidentStatus
+
+	// aggregates are based on all open incidents, independent of the status filter of the info metric
+	h.applyAggregates(opts, incident)
+
+	// incidents which are not exported yet are only added within the series limits
+	exported := h.incidentExported(opts, incident.ID)
+
+	// alert metrics are only exported for open incidents
+	if !incidentIsOpen(incident) {
+		h.incidentCollector.prometheus.incidentAlertCount.DeletePartialMatch(prometheus.Labels{"incidentID": incident.ID})
+		h.incidentCollector.prometheus.incidentAlert.DeletePartialMatch(prometheus.Labels{"incidentID": incident.ID})
+	}
+
+	if !slices.Contains(opts.PagerDuty.Incident.Statuses, incident.Status) {
+		// incident status is not exported (eg. resolved)
+		incidentMetric.DeletePartialMatch(prometheus.Labels{"incidentID": incident.ID})
+		incidentTeamMetric.DeletePartialMatch(prometheus.Labels{"incidentID": incident.ID})
+		incidentStatusMetric.DeletePartialMatch(prometheus.Labels{"incidentID": incident.ID})
+		return true
+	}
+
+	// info metric can only be rebuilt if the payload contains the creation time
+	if incident.CreatedAt != "" && !metricFamilyDisabled(opts, "pagerduty_incident_info") {
+		for _, row := range incidentMetricList.GetList() {
+			// webhook payload only contains the current state, not the acknowledgement/assignment history
+			row.Labels["acknowledged"] = boolToString(incident.Status == "acknowledged")
+			row.Labels["assigned"] = boolToString(len(event.Data.Assignees) >= 1)
+		}
+		applyMetricLabelSettings(opts, "pagerduty_incident_info", incidentMetricList)
+
+		incidentMetric.DeletePartialMatch(prometheus.Labels{"incidentID": incident.ID})
+		// collector exports not more than the incident limit
+		exported = h.setMetricList(opts, "pagerduty_incident_info", incidentMetric, incidentMetricList, int(opts.PagerDuty.Incident.Limit))
+	}
+
+	if !exported {
+		return false
+	}
+
+	if !metricFamilyDisabled(opts, "pagerduty_incident_team") {
+		applyMetricLabelSettings(opts, "pagerduty_incident_team", incidentTeamMetricList)
+		incidentTeamMetric.DeletePartialMatch(prometheus.Labels{"incidentID": incident.ID})
+		h.setMetricList(opts, "pagerduty_incident_team", incidentTeamMetric, incidentTeamMetricList, 0)
+	}
+
+	incidentStatusMetric.DeletePartialMatch(prometheus.Labels{"incidentID": incident.ID, "type": "lastChange"})
+	if eventType == "unacknowledged" {
+		incidentStatusMetric.DeletePartialMatch(prometheus.Labels{"incidentID": incident.ID, "type": "acknowledgement"})
+	}
+	if replaceAssignments {
+		incidentStatusMetric.DeletePartialMatch(prometheus.Labels{"incidentID": incident.ID, "type": "assignment"})
+	}
+
+	if !metricFamilyDisabled(opts, "pagerduty_incident_status") {
+		applyMetricLabelSettings(opts, "pagerduty_incident_status", incidentStatusMetricList)
+		h.setMetricList(opts, "pagerduty_incident_status", incidentStatusMetric, incidentStatusMetricList, 0)
+	}
+
+	return true
+}
+
+// applyAggregates rebuilds the aggregates of the open incidents with the incident of the event, the aggregates
+// are only updated after the first collector run (which provides all other open incidents)
+func (h *webhookAccountHandler) applyAggregates(opts *config.Opts, incident pagerduty.Incident) {
+	openCountMetricList, openOldestAgeMetricList, unacknowledgedCountMetricList, ok := h.incidentCollector.updateOpenIncident(opts, incident)
+	if !ok {
+		return
+	}
+
+	aggregates := []struct {
+		name       string
+		vec        *prometheus.GaugeVec
+		metricList *prometheusCommon.MetricList
+	}{
+		{"pagerduty_incident_open_count", h.incidentCollector.prometheus.incidentOpenCount, openCountMetricList},
+		{"pagerduty_incident_open_oldest_age_seconds", h.incidentCollector.prometheus.incidentOpenOldestAge, openOldestAgeMetricList},
+		{"pagerduty_incident_unacknowledged_count", h.incidentCollector.prometheus.incidentUnacknowledgedCount, unacknowledgedCountMetricList},
+	}
+
+	for _, aggregate := range aggregates {
+		if metricFamilyDisabled(opts, aggregate.name) {
+			continue
+		}
+		applyMetricLabelSettings(opts, aggregate.name, aggregate.metricList)
+		h.incidentCollector.limitMetricSeries(opts, aggregate.name, aggregate.metricList)
+
+		aggregate.vec.Reset()
+		aggregate.metricList.GaugeSet(aggregate.vec)
+	}
+}
+
+// incidentExported returns true if the incident is exported by the info metric (or by the status metric
+// if the info metric is disabled)
+func (h *webhookAccountHandler) incidentExported(opts *config.Opts, incidentID string) bool {
+	var metric prometheus.Collector = h.incidentCollector.prometheus.incident
+	if metricFamilyDisabled(opts, "pagerduty_incident_info") {
+		metric = h.incidentCollector.prometheus.incidentStatus
+	}
+
+	_, exists := metricSeriesOfIncident(metric, incidentID)
+	return exists
+}
+
+// setMetricList sets the metric list if the series limit of the metric family (or the additional limit,
+// 0 = unlimited) is not exceeded, returns false if the series were dropped
+func (h *webhookAccountHandler) setMetricList(opts *config.Opts, name string, vec *prometheus.GaugeVec, metricList *prometheusCommon.MetricList, limit int) bool {
+	maxSeries := metricSeriesLimit(opts, name)
+	if limit > 0 && (maxSeries <= 0 || limit < maxSeries) {
+		maxSeries = limit
+	}
+
+	rows := len(metricList.GetList())
+	if maxSeries > 0 {
+		if count, _ := metricSeriesOfIncident(vec, ""); count+rows > maxSeries {
+			logger.Debug("series limit of metric exceeded, dropping webhook update", slog.String("account", h.account), slog.String("metric", name))
+			PrometheusSeriesDropped.WithLabelValues(h.account, name).Add(float64(rows))
+			return false
+		}
+	}
+
+	metricList.GaugeSet(vec)
+	return true
+}
+
+// metricSeriesOfIncident returns the number of series of the metric and if the incident has a series
+func metricSeriesOfIncident(metric prometheus.Collector, incidentID string) (count int, exists bool) {
+	metricChannel := make(chan prometheus.Metric)
+	go func() {
+		metric.Collect(metricChannel)
+		close(metricChannel)
+	}()
+
+	for series := range metricChannel {
+		count++
+
+		seriesData := dto.Metric{}
+		if exists || incidentID == "" || series.Write(&seriesData) != nil {
+			continue
+		}
+		exists = slices.ContainsFunc(seriesData.GetLabel(), func(label *dto.LabelPair) bool {
+			return label.GetName() == "incidentID" && label.GetValue() == incidentID
+		})
+	}
+
+	return
+}
@@ -0,0 +1,420 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/webdevops/go-common/log/slogger"
+	"github.com/webdevops/go-common/prometheus/collector"
+
+	"github.com/webdevops/pagerduty-exporter/config"
+)
+
+const (
+	testWebhookSecret   = "test-secret"
+	testWebhookIncident = "PGR0VU2"
+)
+
+var (
+	testIncidentCollector     *MetricsCollectorIncident
+	testIncidentCollectorOnce sync.Once
+)
+
+// newTestWebhookHandler returns a webhook handler with an incident collector without metrics, the collector
+// (and its metrics) are registered only once per test binary
+func newTestWebhookHandler(t *testing.T, opts *config.Opts, teamFilter []string) *webhookAccountHandler {
+	t.Helper()
+
+	testIncidentCollectorOnce.Do(func() {
+		if logger == nil {
+			logger = slogger.NewCliLogger(io.Discard)
+		}
+
+		account := &PagerDutyAccount{Name: "test"}
+		account.applyConfig(config.PagerDutyAccount{Name: "test"})
+
+		testIncidentCollector = &MetricsCollectorIncident{PagerDutyProcessor: newPagerDutyProcessor(account, "Incident", nil)}
+		collector.New("test-incident", testIncidentCollector, nil)
+	})
+
+	testIncidentCollector.account.applyConfig(config.PagerDutyAccount{Name: "test", TeamFilter: teamFilter})
+	testIncidentCollector.prometheus.incident.Reset()
+	testIncidentCollector.prometheus.incidentTeam.Reset()
+	testIncidentCollector.prometheus.incidentStatus.Reset()
+	testIncidentCollector.prometheus.incidentOpenCount.Reset()
+	testIncidentCollector.prometheus.incidentOpenOldestAge.Reset()
+	testIncidentCollector.prometheus.incidentUnacknowledgedCount.Reset()
+
+	// simulates a collector run without open incidents
+	testIncidentCollector.lookupLock.Lock()
+	testIncidentCollector.openIncidents = newIncidentAggregates()
+	testIncidentCollector.lookupLock.Unlock()
+
+	currentOpts.Store(opts)
+	t.Cleanup(func() {
+		currentOpts.Store(nil)
+	})
+
+	receiver := &WebhookReceiver{incidentCollectors: map[string]*MetricsCollectorIncident{"test": testIncidentCollector}}
+	receiver.prometheus.events = prometheus.NewCounterVec(
+		prometheus.CounterOpts{Name: "pagerduty_webhook_events_total"},
+		[]string{"account", "eventType", "result"},
+	)
+
+	return &webhookAccountHandler{receiver: receiver, account: "test", incidentCollector: testIncidentCollector}
+}
+
+func newTestWebhookOpts(secrets ...string) *config.Opts {
+	opts := &config.Opts{}
+	opts.PagerDuty.Webhook.Secrets = secrets
+	opts.PagerDuty.Incident.Statuses = []string{"triggered", "acknowledged"}
+	opts.PagerDuty.Incident.TimeFormat = time.RFC3339
+	opts.PagerDuty.Incident.Limit = 5000
+	return opts
+}
+
+func loadWebhookPayload(t *testing.T, name string) []byte {
+	t.Helper()
+
+	payload, err := os.ReadFile(filepath.Join("testdata", "webhook", name+".json"))
+	if err != nil {
+		t.Fatalf("unable to read payload %v: %v", name, err)
+	}
+	return payload
+}
+
+func signWebhookPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// sendWebhook sends the payload to the handler and returns the status code
+func sendWebhook(handler http.Handler, method string, payload []byte, signature string) int {
+	req := httptest.NewRequest(method, "/webhook/pagerduty", bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	if signature != "" {
+		req.Header.Set("X-PagerDuty-Signature", signature)
+	}
+
+	resp := httptest.NewRecorder()
+	handler.ServeHTTP(resp, req)
+	return resp.Code
+}
+
+// metricSeriesLabels returns the labels of all series of the metric
+func metricSeriesLabels(t *testing.T, metric prometheus.Collector) []map[string]string {
+	t.Helper()
+
+	metricChannel := make(chan prometheus.Metric)
+	go func() {
+		metric.Collect(metricChannel)
+		close(metricChannel)
+	}()
+
+	ret := []map[string]string{}
+	for series := range metricChannel {
+		seriesData := dto.Metric{}
+		if err := series.Write(&seriesData); err != nil {
+			t.Fatalf("unable to read series: %v", err)
+		}
+
+		labels := map[string]string{}
+		for _, label := range seriesData.GetLabel() {
+			labels[label.GetName()] = label.GetValue()
+		}
+		ret = append(ret, labels)
+	}
+	return ret
+}
+
+// metricSeriesSum returns the sum of the series values of the metric per value of the label
+func metricSeriesSum(t *testing.T, metric prometheus.Collector, label string) map[string]float64 {
+	t.Helper()
+
+	metricChannel := make(chan prometheus.Metric)
+	go func() {
+		metric.Collect(metricChannel)
+		close(metricChannel)
+	}()
+
+	ret := map[string]float64{}
+	for series := range metricChannel {
+		seriesData := dto.Metric{}
+		if err := series.Write(&seriesData); err != nil {
+			t.Fatalf("unable to read series: %v", err)
+		}
+
+		for _, labelPair := range seriesData.GetLabel() {
+			if labelPair.GetName() == label {
+				ret[labelPair.GetValue()] += seriesData.GetGauge().GetValue()
+			}
+		}
+	}
+	return ret
+}
+
+func TestWebhookSignature(t *testing.T) {
+	payload := loadWebhookPayload(t, "incident.triggered")
+
+	tests := []struct {
+		name      string
+		secrets   []string
+		method    string
+		payload   []byte
+		signature string
+		expected  int
+	}{
+		{
+			name:      "valid signature",
+			secrets:   []string{testWebhookSecret},
+			method:    http.MethodPost,
+			payload:   payload,
+			signature: signWebhookPayload(testWebhookSecret, payload),
+			expected:  http.StatusNoContent,
+		},
+		{
+			name:      "rotated secret",
+			secrets:   []string{"old-secret", testWebhookSecret},
+			method:    http.MethodPost,
+			payload:   payload,
+			signature: signWebhookPayload(testWebhookSecret, payload),
+			expected:  http.StatusNoContent,
+		},
+		{
+			name:      "multiple signatures",
+			secrets:   []string{testWebhookSecret},
+			method:    http.MethodPost,
+			payload:   payload,
+			signature: signWebhookPayload("old-secret", payload) + "," + signWebhookPayload(testWebhookSecret, payload),
+			expected:  http.StatusNoContent,
+		},
+		{
+			name:      "wrong secret",
+			secrets:   []string{testWebhookSecret},
+			method:    http.MethodPost,
+			payload:   payload,
+			signature: signWebhookPayload("wrong-secret", payload),
+			expected:  http.StatusUnauthorized,
+		},
+		{
+			name:      "modified payload",
+			secrets:   []string{testWebhookSecret},
+			method:    http.MethodPost,
+			payload:   bytes.Replace(payload, []byte(`"urgency": "high"`), []byte(`"urgency": "low"`), 1),
+			signature: signWebhookPayload(testWebhookSecret, payload),
+			expected:  http.StatusUnauthorized,
+		},
+		{
+			name:     "missing signature",
+			secrets:  []string{testWebhookSecret},
+			method:   http.MethodPost,
+			payload:  payload,
+			expected: http.StatusUnauthorized,
+		},
+		{
+			name:      "malformed signature",
+			secrets:   []string{testWebhookSecret},
+			method:    http.MethodPost,
+			payload:   payload,
+			signature: "v1=invalid",
+			expected:  http.StatusUnauthorized,
+		},
+		{
+			name:      "invalid payload",
+			secrets:   []string{testWebhookSecret},
+			method:    http.MethodPost,
+			payload:   []byte(`{"event":`),
+			signature: signWebhookPayload(testWebhookSecret, []byte(`{"event":`)),
+			expected:  http.StatusBadRequest,
+		},
+		{
+			name:     "method not allowed",
+			secrets:  []string{testWebhookSecret},
+			method:   http.MethodGet,
+			expected: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := newTestWebhookHandler(t, newTestWebhookOpts(test.secrets...), nil)
+
+			if code := sendWebhook(handler, test.method, test.payload, test.signature); code != test.expected {
+				t.Fatalf("expected status %d, got %d", test.expected, code)
+			}
+
+			_, exported := metricSeriesOfIncident(handler.incidentCollector.prometheus.incident, testWebhookIncident)
+			if expected := test.expected == http.StatusNoContent; exported != expected {
+				t.Errorf("expected incident exported: %v, got %v", expected, exported)
+			}
+		})
+	}
+}
+
+func TestWebhookPayload(t *testing.T) {
+	tests := []struct {
+		name       string
+		payloads   []string
+		teamFilter []string
+		// expected labels of the info metric (nil = incident not exported)
+		expectedInfo   map[string]string
+		expectedTeams  []string
+		expectedStatus map[string]int
+		// expected open incidents per status and unacknowledged incidents per service
+		expectedOpen           map[string]float64
+		expectedUnacknowledged map[string]float64
+	}{
+		{
+			name:     "triggered",
+			payloads: []string{"incident.triggered"},
+			expectedInfo: map[string]string{
+				"incidentID":         testWebhookIncident,
+				"serviceID":          "PF9KMXH",
+				"incidentUrl":        "https://acme.pagerduty.com/incidents/PGR0VU2",
+				"incidentNumber":     "2",
+				"title":              "A little bump in the road",
+				"status":             "triggered",
+				"urgency":            "high",
+				"acknowledged":       "false",
+				"assigned":           "true",
+				"type":               "incident",
+				"time":               "2020-04-09T15:16:27Z",
+				"priorityID":         "PSO75BM",
+				"priorityName":       "P1",
+				"escalationPolicyID": "PUS0KTE",
+			},
+			expectedTeams:          []string{"PFCVPS0"},
+			expectedStatus:         map[string]int{"assignment": 1, "lastChange": 1},
+			expectedOpen:           map[string]float64{"triggered": 1},
+			expectedUnacknowledged: map[string]float64{"PF9KMXH": 1},
+		},
+		{
+			name:     "acknowledged",
+			payloads: []string{"incident.triggered", "incident.acknowledged"},
+			expectedInfo: map[string]string{
+				"incidentID":   testWebhookIncident,
+				"status":       "acknowledged",
+				"acknowledged": "true",
+				"assigned":     "true",
+			},
+			expectedTeams:          []string{"PFCVPS0"},
+			expectedStatus:         map[string]int{"acknowledgement": 1, "assignment": 1, "lastChange": 1},
+			expectedOpen:           map[string]float64{"acknowledged": 1},
+			expectedUnacknowledged: map[string]float64{},
+		},
+		{
+			name:                   "resolved",
+			payloads:               []string{"incident.triggered", "incident.acknowledged", "incident.resolved"},
+			expectedStatus:         map[string]int{},
+			expectedOpen:           map[string]float64{},
+			expectedUnacknowledged: map[string]float64{},
+		},
+		{
+			name:                   "other resource type",
+			payloads:               []string{"service.updated"},
+			expectedStatus:         map[string]int{},
+			expectedOpen:           map[string]float64{},
+			expectedUnacknowledged: map[string]float64{},
+		},
+		{
+			name:       "team filter matches",
+			payloads:   []string{"incident.triggered"},
+			teamFilter: []string{"PFCVPS0", "POTHER1"},
+			expectedInfo: map[string]string{
+				"incidentID": testWebhookIncident,
+				"status":     "triggered",
+			},
+			expectedTeams:          []string{"PFCVPS0"},
+			expectedStatus:         map[string]int{"assignment": 1, "lastChange": 1},
+			expectedOpen:           map[string]float64{"triggered": 1},
+			expectedUnacknowledged: map[string]float64{"PF9KMXH": 1},
+		},
+		{
+			name:                   "team filter excludes incident",
+			payloads:               []string{"incident.triggered"},
+			teamFilter:             []string{"POTHER1"},
+			expectedStatus:         map[string]int{},
+			expectedOpen:           map[string]float64{},
+			expectedUnacknowledged: map[string]float64{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			handler := newTestWebhookHandler(t, newTestWebhookOpts(testWebhookSecret), test.teamFilter)
+
+			for _, name := range test.payloads {
+				payload := loadWebhookPayload(t, name)
+				if code := sendWebhook(handler, http.MethodPost, payload, signWebhookPayload(testWebhookSecret, payload)); code != http.StatusNoContent {
+					t.Fatalf("%v: expected status %d, got %d", name, http.StatusNoContent, code)
+				}
+			}
+
+			infoSeries := metricSeriesLabels(t, handler.incidentCollector.prometheus.incident)
+			if test.expectedInfo == nil {
+				if len(infoSeries) != 0 {
+					t.Fatalf("expected no info series, got %v", infoSeries)
+				}
+			} else {
+				if len(infoSeries) != 1 {
+					t.Fatalf("expected one info series, got %v", infoSeries)
+				}
+				for label, expected := range test.expectedInfo {
+					if value := infoSeries[0][label]; value != expected {
+						t.Errorf("label %v: expected %q, got %q", label, expected, value)
+					}
+				}
+			}
+
+			teams := []string{}
+			for _, labels := range metricSeriesLabels(t, handler.incidentCollector.prometheus.incidentTeam) {
+				teams = append(teams, labels["teamID"])
+			}
+			if len(teams) != len(test.expectedTeams) {
+				t.Fatalf("expected teams %v, got %v", test.expectedTeams, teams)
+			}
+			for i, expected := range test.expectedTeams {
+				if teams[i] != expected {
+					t.Errorf("expected teams %v, got %v", test.expectedTeams, teams)
+				}
+			}
+
+			status := map[string]int{}
+			for _, labels := range metricSeriesLabels(t, handler.incidentCollector.prometheus.incidentStatus) {
+				status[labels["type"]]++
+			}
+			if len(status) != len(test.expectedStatus) {
+				t.Fatalf("expected status series %v, got %v", test.expectedStatus, status)
+			}
+			for statusType, expected := range test.expectedStatus {
+				if status[statusType] != expected {
+					t.Errorf("expected status series %v, got %v", test.expectedStatus, status)
+				}
+			}
+
+			if open := metricSeriesSum(t, handler.incidentCollector.prometheus.incidentOpenCount, "status"); !maps.Equal(open, test.expectedOpen) {
+				t.Errorf("expected open incidents %v, got %v", test.expectedOpen, open)
+			}
+			if unacknowledged := metricSeriesSum(t, handler.incidentCollector.prometheus.incidentUnacknowledgedCount, "serviceID"); !maps.Equal(unacknowledged, test.expectedUnacknowledged) {
+				t.Errorf("expected unacknowledged incidents %v, got %v", test.expectedUnacknowledged, unacknowledged)
+			}
+			if oldest, expected := len(metricSeriesLabels(t, handler.incidentCollector.prometheus.incidentOpenOldestAge)), len(test.expectedOpen); oldest != expected {
+				t.Errorf("expected %d oldest age series, got %d", expected, oldest)
+			}
+		})
+	}
+}